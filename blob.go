@@ -0,0 +1,41 @@
+package tnt
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// Blob значение VARBINARY колонки
+//
+// В параметрах вместо Blob можно передать любой io.Reader, он будет прочитан в память целиком
+// и отправлен как varbinary (msgpack bin). Reader одноразовый, поэтому запрос с ним драйвер
+// не дает database/sql повторить на другом соединении
+type Blob []byte
+
+// Прочитанный io.Reader параметр, отличается от []byte только тем, что запрос с ним нельзя повторить
+type readerData []byte
+
+func (b *Blob) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*b = nil
+	case []byte:
+		*b = append((*b)[:0], src...)
+	case string:
+		*b = append((*b)[:0], src...)
+	default:
+		return fmt.Errorf("Scan: unable to scan type %T into tnt.Blob", src)
+	}
+	return nil
+}
+
+// Reader для потоковой обработки значения (например, передачи в proto.Unmarshal или io.Copy)
+func (b Blob) Reader() io.Reader {
+	return bytes.NewReader(b)
+}
+
+func (b Blob) Value() (driver.Value, error) {
+	return []byte(b), nil
+}
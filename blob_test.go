@@ -0,0 +1,83 @@
+package tnt
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+func TestRowsNextVarbinary(t *testing.T) {
+	raw := []byte{0, 1, 2}
+	r := &rows{
+		data:      []interface{}{[]interface{}{raw}},
+		cMetaData: []tarantool.ColumnMetaData{{FieldName: "data", FieldType: "varbinary"}},
+	}
+	dest := make([]driver.Value, 1)
+	if err := r.Next(dest); err != nil {
+		t.Fatalf("unexpected error for Next: %v", err)
+	}
+	got, ok := dest[0].([]byte)
+	if !ok || !bytes.Equal(got, raw) {
+		t.Fatalf("value mismatch\nGot: %#v\nWant: %#v", dest[0], raw)
+	}
+	raw[0] = 42
+	if got[0] != 0 {
+		t.Fatal("value must be copied from the response buffer")
+	}
+
+	var b Blob
+	if err := b.Scan(got); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(b.Reader())
+	if err != nil || !bytes.Equal(data, []byte{0, 1, 2}) {
+		t.Fatalf("Reader mismatch: %v, %v", data, err)
+	}
+	if err := b.Scan(nil); err != nil || b != nil {
+		t.Fatalf("Scan(nil) = %v, %v", b, err)
+	}
+}
+
+func TestCheckNamedValueReader(t *testing.T) {
+	nv := &driver.NamedValue{Ordinal: 1, Value: strings.NewReader("payload")}
+	if err := checkNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := nativeValue(nv.Value).([]byte); !ok || string(got) != "payload" {
+		t.Fatalf("reader is not read into []byte: %#v", nv.Value)
+	}
+	nv = &driver.NamedValue{Ordinal: 1, Value: Blob("payload")}
+	if err := checkNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := nativeValue(nv.Value).([]byte); !ok || string(got) != "payload" {
+		t.Fatalf("blob is not converted to []byte: %#v", nv.Value)
+	}
+}
+
+func TestReaderArgsNotRetried(t *testing.T) {
+	notReady := tarantool.ClientError{Code: tarantool.ErrConnectionNotReady, Msg: "client connection is not ready"}
+	reader := &driver.NamedValue{Ordinal: 1, Value: strings.NewReader("payload")}
+	if err := checkNamedValue(reader); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStmt(&conn{}, `INSERT INTO "files" VALUES (?)`, nil)
+	if err := s.checkErr(notReady, []driver.NamedValue{{Ordinal: 1, Value: []byte("payload")}}); !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("unexpected error without reader\nGot: %v\nWant: %v", err, driver.ErrBadConn)
+	}
+
+	s = NewStmt(&conn{}, `INSERT INTO "files" VALUES (?)`, nil)
+	err := s.checkErr(notReady, []driver.NamedValue{*reader})
+	if errors.Is(err, driver.ErrBadConn) || !errors.Is(err, notReady) {
+		t.Fatalf("query with consumed reader must not be retried, got: %v", err)
+	}
+	if !s.conn.bad {
+		t.Fatal("conn is not marked as bad")
+	}
+}
@@ -0,0 +1,114 @@
+package tnt
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+/*
+	Приведение пользовательских типов к параметрам запроса (вызывается из checkNamedValue)
+
+	Порядок такой:
+	1. Конвертер, зарегистрированный через RegisterConverter для точного типа значения,
+	его результат уходит в тарантул как есть (после приведения к msgpack расширениям, см. nativeValue)
+	2. Типы, которые драйвер передает сам (uuid, время, decimal и т.п.), в том числе если они
+	реализуют driver.Valuer - иначе, например, uuid.UUID превратился бы в строку.
+	Произвольные map и слайсы - только если у них нет Value (tnt.Map, tnt.Array и tnt.Blob передаются как есть)
+	3. driver.Valuer, nil-указатели, указатели и именованные базовые типы (type Status string),
+	результат проверяется заново
+*/
+
+var (
+	convertersMu sync.RWMutex
+	converters   = make(map[reflect.Type]func(interface{}) (driver.Value, error))
+)
+
+// RegisterConverter регистрирует преобразование значений типа T в параметр запроса
+//
+// Результат передается в тарантул без дополнительных проверок, так что конвертер может вернуть
+// значение с собственным msgpack расширением. Повторная регистрация для того же типа заменяет конвертер
+//
+//	tnt.RegisterConverter(func(m Money) (driver.Value, error) {
+//		return decimal.New(m.Cents, -2), nil
+//	})
+func RegisterConverter[T any](fn func(T) (driver.Value, error)) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters[reflect.TypeOf((*T)(nil)).Elem()] = func(v interface{}) (driver.Value, error) {
+		return fn(v.(T))
+	}
+}
+
+func init() {
+	// Valuer этих типов отдает строку, а тарантулу нужны msgpack расширения
+	RegisterConverter(func(u uuid.NullUUID) (driver.Value, error) {
+		if !u.Valid {
+			return nil, nil
+		}
+		return u.UUID, nil
+	})
+	RegisterConverter(func(d decimal.NullDecimal) (driver.Value, error) {
+		if !d.Valid {
+			return nil, nil
+		}
+		return d.Decimal, nil
+	})
+}
+
+func lookupConverter(v interface{}) (func(interface{}) (driver.Value, error), bool) {
+	if v == nil {
+		return nil, false
+	}
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+	conv, ok := converters[reflect.TypeOf(v)]
+	return conv, ok
+}
+
+// Ограничение на цепочку Valuer'ов, возвращающих друг друга
+const maxConvertDepth = 16
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// Приведение значения неподдерживаемого напрямую типа, ok = false если привести нельзя
+func fallbackValue(v interface{}) (res driver.Value, ok bool, err error) {
+	rv := reflect.ValueOf(v)
+	if valuer, isValuer := v.(driver.Valuer); isValuer {
+		// как в database/sql: nil-указатель на тип с Value по значению - это NULL
+		if rv.Kind() == reflect.Pointer && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+			return nil, true, nil
+		}
+		res, err = valuer.Value()
+		return res, true, err
+	}
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, true, nil
+		}
+		return rv.Elem().Interface(), true, nil
+	case reflect.String:
+		return rv.String(), true, nil
+	case reflect.Bool:
+		return rv.Bool(), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true, nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true, nil
+	}
+	return nil, false, nil
+}
+
+var errConvertDepth = errors.New("too many nested driver.Valuer conversions")
+
+func convertError(value *driver.NamedValue, err error) error {
+	return fmt.Errorf("can't convert parameter %d (%T): %w", value.Ordinal, value.Value, err)
+}
@@ -0,0 +1,103 @@
+package tnt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	stdtime "time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/tarantool/go-tarantool/datetime"
+)
+
+type testStatus string
+
+type testMoney struct{ cents int64 }
+
+func (m testMoney) Value() (driver.Value, error) {
+	return m.cents, nil
+}
+
+type testLoop struct{}
+
+func (l testLoop) Value() (driver.Value, error) {
+	return l, nil
+}
+
+type testFailing struct{}
+
+func (testFailing) Value() (driver.Value, error) {
+	return nil, errors.New("boom")
+}
+
+type testPoint struct{ x, y int }
+
+type testTags []string
+
+func (tags testTags) Value() (driver.Value, error) {
+	return strings.Join(tags, ","), nil
+}
+
+type testIDs []int64
+
+func TestCheckNamedValueConvert(t *testing.T) {
+	RegisterConverter(func(p testPoint) (driver.Value, error) {
+		return []int{p.x, p.y}, nil
+	})
+	status := testStatus("active")
+	at := stdtime.Date(2023, 1, 2, 0, 0, 0, 0, stdtime.UTC)
+	dt, err := datetime.NewDatetime(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	tests := []struct {
+		value     interface{}
+		want      interface{}
+		wantError bool
+	}{
+		{value: status, want: "active"},
+		{value: &status, want: "active"},
+		{value: (*testStatus)(nil), want: nil},
+		{value: int32(7), want: int64(7)},
+		{value: testMoney{cents: 100}, want: int64(100)},
+		{value: (*testMoney)(nil), want: nil},
+		{value: sql.NullInt64{Int64: 5, Valid: true}, want: int64(5)},
+		{value: sql.NullString{}, want: nil},
+		{value: sql.NullTime{Time: at, Valid: true}, want: *dt},
+		{value: at, want: *dt},
+		{value: uuid.NullUUID{UUID: id, Valid: true}, want: id},
+		{value: uuid.NullUUID{}, want: nil},
+		{value: id, want: id}, // uuid.UUID реализует Valuer, но передается расширением
+		{value: testPoint{x: 1, y: 2}, want: []int{1, 2}},
+		{value: testTags{"a", "b"}, want: "a,b"},
+		{value: testIDs{1, 2}, want: testIDs{1, 2}},
+		{value: Array{int64(1), "a"}, want: Array{int64(1), "a"}},
+		{value: Map{"a": int64(1)}, want: Map{"a": int64(1)}},
+		{value: testLoop{}, wantError: true},
+		{value: testFailing{}, wantError: true},
+		{value: struct{}{}, wantError: true},
+	}
+	for _, tc := range tests {
+		nv := &driver.NamedValue{Ordinal: 1, Value: tc.value}
+		err := checkNamedValue(nv)
+		if err != nil {
+			if !tc.wantError {
+				t.Errorf("unexpected error for %T: %v", tc.value, err)
+			}
+			continue
+		}
+		if tc.wantError {
+			t.Errorf("did not encounter expected error for %T", tc.value)
+			continue
+		}
+		if !cmp.Equal(nv.Value, tc.want, cmp.Comparer(func(a, b datetime.Datetime) bool {
+			return a.ToTime().Equal(b.ToTime())
+		})) {
+			t.Errorf("value mismatch for %T\nGot: %#v\nWant: %#v", tc.value, nv.Value, tc.want)
+		}
+	}
+}
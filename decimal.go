@@ -0,0 +1,109 @@
+package tnt
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
+)
+
+// Точность decimal в тарантуле - 38 значащих цифр
+const decimalPrecision = 38
+
+// Decimal тип для сканирования DECIMAL колонок и передачи decimal параметров
+//
+// Значение хранится без потери точности, в отличие от float64, поэтому подходит для денег и т.п.
+// В параметрах также можно передавать decimal.Decimal (shopspring), *big.Rat и decimal.Decimal из go-tarantool
+type Decimal struct {
+	decimal.Decimal
+}
+
+func (d *Decimal) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		v, err := decimal.NewFromString(src)
+		if err != nil {
+			return fmt.Errorf("Scan: %v", err)
+		}
+		d.Decimal = v
+	case []byte:
+		v, err := decimal.NewFromString(string(src))
+		if err != nil {
+			return fmt.Errorf("Scan: %v", err)
+		}
+		d.Decimal = v
+	case int64:
+		d.Decimal = decimal.NewFromInt(src)
+	case uint64:
+		d.Decimal = decimal.NewFromBigInt(new(big.Int).SetUint64(src), 0)
+	case float64:
+		d.Decimal = decimal.NewFromFloat(src)
+	default:
+		return fmt.Errorf("Scan: unable to scan type %T into tnt.Decimal", src)
+	}
+	return nil
+}
+
+// Value нужен для драйверов/оберток, которые не используют CheckNamedValue,
+// сам драйвер передает Decimal msgpack расширением
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Приведение поддерживаемых decimal типов к go-tarantool decimal, для которого зарегистрировано
+// msgpack расширение, ok = false для остальных типов
+func decimalValue(value driver.Value) (v driver.Value, ok bool) {
+	switch d := value.(type) {
+	case Decimal:
+		return tntdecimal.NewDecimal(d.Decimal), true
+	case *Decimal:
+		if d == nil {
+			return nil, true
+		}
+		return tntdecimal.NewDecimal(d.Decimal), true
+	case decimal.Decimal:
+		return tntdecimal.NewDecimal(d), true
+	case *decimal.Decimal:
+		if d == nil {
+			return nil, true
+		}
+		return tntdecimal.NewDecimal(*d), true
+	case tntdecimal.Decimal:
+		return &d, true
+	case *tntdecimal.Decimal:
+		if d == nil {
+			return nil, true
+		}
+		return d, true
+	case *big.Rat:
+		if d == nil {
+			return nil, true
+		}
+		return tntdecimal.NewDecimal(ratToDecimal(d)), true
+	}
+	return nil, false
+}
+
+// Дробь переводится в decimal с точностью тарантула, бесконечные дроби (1/3) округляются
+func ratToDecimal(r *big.Rat) decimal.Decimal {
+	num := decimal.NewFromBigInt(r.Num(), 0)
+	if r.IsInt() {
+		return num
+	}
+	intDigits := 0
+	if q := new(big.Int).Quo(r.Num(), r.Denom()); q.Sign() != 0 {
+		intDigits = len(q.Text(10))
+		if q.Sign() < 0 {
+			intDigits--
+		}
+	}
+	scale := decimalPrecision - intDigits
+	if scale < 0 {
+		scale = 0
+	}
+	return num.DivRound(decimal.NewFromBigInt(r.Denom(), 0), int32(scale))
+}
@@ -0,0 +1,83 @@
+package tnt
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
+)
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		want    string
+		wantErr bool
+	}{
+		{src: "12345678901234567890.123456789", want: "12345678901234567890.123456789"},
+		{src: []byte("-0.5"), want: "-0.5"},
+		{src: int64(42), want: "42"},
+		{src: uint64(18446744073709551615), want: "18446744073709551615"},
+		{src: 1.25, want: "1.25"},
+		{src: "abc", wantErr: true},
+		{src: true, wantErr: true},
+	}
+	for _, tc := range tests {
+		var d Decimal
+		err := d.Scan(tc.src)
+		if err != nil {
+			if !tc.wantErr {
+				t.Errorf("unexpected error for Scan(%v): %v", tc.src, err)
+			}
+			continue
+		}
+		if tc.wantErr {
+			t.Errorf("did not encounter expected error for Scan(%v)", tc.src)
+		}
+		if d.String() != tc.want {
+			t.Errorf("Scan(%v) = %v, want %v", tc.src, d, tc.want)
+		}
+	}
+}
+
+func TestDecimalValue(t *testing.T) {
+	want := decimal.RequireFromString("10.01")
+	shop := want
+	tnt := tntdecimal.NewDecimal(want)
+	for _, v := range []interface{}{Decimal{want}, &Decimal{want}, shop, &shop, *tnt, tnt, big.NewRat(1001, 100)} {
+		got, ok := decimalValue(v)
+		if !ok {
+			t.Fatalf("%T is not converted", v)
+		}
+		d, ok := got.(*tntdecimal.Decimal)
+		if !ok {
+			t.Fatalf("%T is converted to %T, want *decimal.Decimal", v, got)
+		}
+		if !d.Equal(want) {
+			t.Errorf("%T is converted to %v, want %v", v, d, want)
+		}
+	}
+	if got, ok := decimalValue((*big.Rat)(nil)); !ok || got != nil {
+		t.Errorf("nil *big.Rat is converted to %v, %v", got, ok)
+	}
+	if _, ok := decimalValue(1.5); ok {
+		t.Error("float64 must not be converted to decimal")
+	}
+}
+
+func TestRatToDecimal(t *testing.T) {
+	tests := []struct {
+		rat  *big.Rat
+		want string
+	}{
+		{rat: big.NewRat(7, 1), want: "7"},
+		{rat: big.NewRat(-1, 4), want: "-0.25"},
+		{rat: big.NewRat(1, 3), want: "0.33333333333333333333333333333333333333"},
+		{rat: big.NewRat(-200, 3), want: "-66.666666666666666666666666666666666667"},
+	}
+	for _, tc := range tests {
+		if got := ratToDecimal(tc.rat).String(); got != tc.want {
+			t.Errorf("ratToDecimal(%v) = %v, want %v", tc.rat, got, tc.want)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package tnt
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
+	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"github.com/tarantool/go-tarantool"
 )
 
@@ -58,6 +63,66 @@ func TestSimpleQuery(t *testing.T) {
 	}
 }
 
+func TestQueryCanceledContext(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	dropSleep := createTestDBSleepFunc(t, getTestDBdsn(t))
+	defer dropSleep()
+
+	// дедлайн истекает, когда запрос уже выполняется на сервере
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := db.QueryContext(ctx, `SELECT "TEST_SLEEP"(?)`, 5)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error for QueryContext with deadline\nGot: %v\nWant: %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("query was not interrupted by deadline, took %v", elapsed)
+	}
+
+	// соединение после таймаута остается рабочим
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error for ping after deadline: %v", err)
+	}
+}
+
+// Lua функция TEST_SLEEP(seconds), доступная из SQL, для медленных запросов
+func createTestDBSleepFunc(t *testing.T, dsn string) (drop func()) {
+	config, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("unexpected error for extract config: %v", err)
+	}
+	conn, err := tarantool.Connect(config.Addr, tarantool.Opts{User: config.User, Pass: config.Password})
+	if err != nil {
+		t.Fatalf("unexpected error for tarantool.Connect: %v", err)
+	}
+	_, err = conn.Call("box.schema.func.create", []interface{}{
+		"TEST_SLEEP",
+		map[string]interface{}{
+			"language":         "LUA",
+			"body":             `function(s) require('fiber').sleep(s) return true end`,
+			"returns":          "boolean",
+			"param_list":       []string{"number"},
+			"exports":          []string{"LUA", "SQL"},
+			"is_deterministic": false,
+			"if_not_exists":    true,
+		}})
+	if err != nil {
+		conn.Close()
+		t.Fatalf("unexpected error for conn.Call(func.create): %v", err)
+	}
+	return func() {
+		defer conn.Close()
+		_, err := conn.Call("box.schema.func.drop", []interface{}{"TEST_SLEEP", map[string]bool{"if_exists": true}})
+		if err != nil {
+			t.Errorf("unexpected error for conn.Call(func.drop): %v", err)
+		}
+	}
+}
+
 /* Транзакции */
 
 func TestSimpleReadWriteTransactionCommit(t *testing.T) {
@@ -148,6 +213,254 @@ func TestSimpleReadWriteTransactionRollback(t *testing.T) {
 	}()
 }
 
+func TestNestedTransactionSavepoints(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	errNested := errors.New("nested failed")
+	err = WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 3); err != nil {
+			return err
+		}
+		// вложенная "транзакция" откатывается, внешняя продолжается
+		err := WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 4); err != nil {
+				return err
+			}
+			return errNested
+		})
+		if !errors.Is(err, errNested) {
+			t.Fatalf("unexpected error for nested WithSavepoint\nGot: %v\nWant: %v", err, errNested)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for WithSavepoint: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected error for tx.Commit: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, SelectFooFromBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	checkSelectFooFromBarResult(t, rows, 3)
+}
+
+func TestTransactionTimeout(t *testing.T) {
+	// t.Parallel()
+
+	dsn := getTestDBdsn(t)
+	teardown := setupTestDBData(t, dsn)
+	defer teardown()
+	config, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TxTimeout = 100 * time.Millisecond
+	connector, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 3); err != nil {
+		t.Fatalf("unexpected error for tx.ExecContext: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if err := tx.Commit(); !IsTransactionTimeout(err) {
+		t.Fatalf("unexpected error for tx.Commit after tx_timeout: %v", err)
+	}
+}
+
+func TestPreparedStmtInTransaction(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// выражение готовится до начала транзакции, как в sqlc с подготовленными запросами и WithTx
+	stmt, err := conn.PrepareContext(ctx, `INSERT INTO "BAR" VALUES (?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.StmtContext(ctx, stmt).ExecContext(ctx, 3); err != nil {
+		t.Fatalf("unexpected error for tx.StmtContext(...).ExecContext: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error for tx.Rollback: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, SelectFooFromBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	checkSelectFooFromBarResult(t, rows, 2)
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+
+	// обе транзакции на разных "внутренних" соединениях, но на одном tarantool соединении
+	tx1, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	tx2, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx2.Rollback()
+
+	if _, err := tx1.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 3); err != nil {
+		t.Fatalf("unexpected error for tx1.ExecContext: %v", err)
+	}
+	// незакоммиченная вставка tx1 не видна в tx2
+	func() {
+		rows, err := tx2.QueryContext(ctx, SelectFooFromBar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		checkSelectFooFromBarResult(t, rows, 2)
+	}()
+	if err := tx2.Rollback(); err != nil {
+		t.Fatalf("unexpected error for tx2.Rollback: %v", err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("unexpected error for tx1.Commit: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, SelectFooFromBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	checkSelectFooFromBarResult(t, rows, 3)
+}
+
+func TestConnReuseAfterTransaction(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 3); err != nil {
+		t.Fatalf("unexpected error for tx.ExecContext: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error for tx.Rollback: %v", err)
+	}
+
+	// после rollback соединение работает вне транзакции, вставка сразу видна другим
+	if _, err := conn.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, 3); err != nil {
+		t.Fatalf("unexpected error for conn.ExecContext: %v", err)
+	}
+	rows, err := db.QueryContext(ctx, SelectFooFromBar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	checkSelectFooFromBarResult(t, rows, 3)
+
+	// и может открыть новую транзакцию
+	tx, err = conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error for second BeginTx: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected error for tx.Commit: %v", err)
+	}
+}
+
+func TestFetchSizeKeyset(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+	for i := 3; i <= 7; i++ {
+		if _, err := db.ExecContext(ctx, `INSERT INTO "BAR" VALUES (?)`, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// страницы по 2 строки, все 7 строк без пропусков и дублей, в порядке ORDER BY
+	for _, order := range []string{"", " DESC"} {
+		rows, err := db.QueryContext(WithFetchSize(ctx, 2), SelectFooFromBar+` ORDER BY FOO`+order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("unexpected error for rows.Err: %v", err)
+		}
+		rows.Close()
+		if len(got) != 7 {
+			t.Fatalf("paged rows mismatch%s\nGot: %v\nWant: 7 rows", order, got)
+		}
+		for i := range got {
+			want := int64(i + 1)
+			if order != "" {
+				want = int64(7 - i)
+			}
+			if got[i] != want {
+				t.Fatalf("paged rows order mismatch%s\nGot: %v", order, got)
+			}
+		}
+	}
+}
+
 func checkSelectFooFromBarResult(t *testing.T, rows *sql.Rows, count int64) {
 	for want := int64(1); rows.Next(); want++ {
 		cols, err := rows.Columns()
@@ -207,40 +520,107 @@ func TestPreparedQueryUnnamed(t *testing.T) {
 	}
 }
 
-// Фейлится из-за того, что не работают нормально именованные параметры
-
-// func TestPreparedQueryNamed(t *testing.T) {
-// 	// t.Parallel()
-
-// 	db, teardown := setupTestDBConnection(t)
-// 	defer teardown()
-
-// 	stmt, err := db.Prepare(`SELECT "id" FROM "Test" WHERE "name"=:name`)
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
-// 	defer stmt.Close()
-
-// 	rows, err := stmt.QueryContext(context.Background(), sql.NamedArg{Name: "name", Value: "Alice"})
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
-// 	defer rows.Close()
-
-// 	for want := int64(1); rows.Next(); want++ {
-// 		var got int64
-// 		err = rows.Scan(&got)
-// 		if err != nil {
-// 			t.Fatal(err)
-// 		}
-// 		if got != want {
-// 			t.Fatalf("value mismatch\nGot: %v\nWant: %v", got, want)
-// 		}
-// 	}
-// 	if rows.Err() != nil {
-// 		t.Fatal(rows.Err())
-// 	}
-// }
+func TestPreparedQueryReuse(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	stmt, err := db.Prepare(`SELECT "name" FROM "Test" WHERE "id"=?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int64]string{1: "Alice", 2: "Bob"} {
+		var got string
+		if err := stmt.QueryRowContext(context.Background(), id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("value mismatch\nGot: %v\nWant: %v", got, want)
+		}
+	}
+	if err := stmt.Close(); err != nil {
+		t.Fatalf("unexpected error for stmt.Close: %v", err)
+	}
+}
+
+func TestPreparedQuerySharedSession(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+	ctx := context.Background()
+
+	// два соединения database/sql поверх одной сессии тарантула (pool_size по умолчанию 1)
+	conn1, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn1.Close()
+	conn2, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+
+	const query = `SELECT "name" FROM "Test" WHERE "id"=?`
+	stmt1, err := conn1.PrepareContext(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt2, err := conn2.PrepareContext(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt2.Close()
+	if err := stmt1.Close(); err != nil {
+		t.Fatalf("unexpected error for stmt.Close: %v", err)
+	}
+
+	// закрытие stmt1 не должно удалить выражение, которое использует stmt2
+	var got string
+	if err := stmt2.QueryRowContext(ctx, 1).Scan(&got); err != nil {
+		t.Fatalf("unexpected error for shared prepared statement: %v", err)
+	}
+	if got != "Alice" {
+		t.Fatalf("value mismatch\nGot: %v\nWant: %v", got, "Alice")
+	}
+}
+
+func TestPreparedQueryNamed(t *testing.T) {
+	// t.Parallel()
+
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	// один и тот же именованный параметр может встречаться в запросе несколько раз
+	stmt, err := db.Prepare(`SELECT "id" FROM "Test" WHERE "name"=:name OR UPPER("name")=UPPER(:name)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(context.Background(), sql.NamedArg{Name: "name", Value: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	for want := int64(1); rows.Next(); want++ {
+		var got int64
+		err = rows.Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("value mismatch\nGot: %v\nWant: %v", got, want)
+		}
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+}
 
 func TestAllTypeExec(t *testing.T) {
 	db, teardown := setupTestDBConnection(t)
@@ -321,6 +701,40 @@ func TestAllTypeExec(t *testing.T) {
 	}()
 }
 
+func TestDecimalQuery(t *testing.T) {
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	want := decimal.RequireFromString("12345678901234567890.0123456789")
+	var got Decimal
+	var str string
+	var f float64
+	err := db.QueryRowContext(context.Background(), `SELECT ?, ?, ?`, want, big.NewRat(1, 4), Decimal{want}).Scan(&got, &str, &f)
+	if err != nil {
+		t.Fatalf("unexpected error for QueryRowContext: %v", err)
+	}
+	if !got.Equal(want) || str != "0.25" || f != 12345678901234567890.0123456789 {
+		t.Fatalf("value mismatch\nGot: %v, %v, %v\nWant: %v, 0.25, %v", got, str, f, want, want)
+	}
+}
+
+func TestVarbinaryQuery(t *testing.T) {
+	db, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	want := []byte{0, 0xff, 'a'}
+	var got []byte
+	var blob Blob
+	var typ string
+	err := db.QueryRowContext(context.Background(), `SELECT ?, ?, TYPEOF(?)`, want, bytes.NewReader(want), want).Scan(&got, &blob, &typ)
+	if err != nil {
+		t.Fatalf("unexpected error for QueryRowContext: %v", err)
+	}
+	if !bytes.Equal(got, want) || !bytes.Equal(blob, want) || typ != "varbinary" {
+		t.Fatalf("value mismatch\nGot: %v, %v, %v\nWant: %v, %v, varbinary", got, blob, typ, want, want)
+	}
+}
+
 func TestAllPointersTypeExec(t *testing.T) {
 	db, teardown := setupTestDBConnection(t)
 	defer teardown()
@@ -375,12 +789,12 @@ func getTestDBdsn(t *testing.T) (dsn string) {
 
 func setupTestDBData(t *testing.T, dsn string) (teardown func()) {
 	fns := make([]func(), 0)
-	config, err := extractConnectorConfig(dsn)
+	config, err := ParseDSN(dsn)
 	if err != nil {
 		t.Fatalf("unexpected error for extract config: %v", err)
 	}
-	fns = append(fns, creaeteTestDBSchema(t, &config))
-	fns = append(fns, insertTestDBValues(t, &config))
+	fns = append(fns, creaeteTestDBSchema(t, config))
+	fns = append(fns, insertTestDBValues(t, config))
 	teardown = func() {
 		for i, j := 0, len(fns)-1; i < j; i, j = i+1, j-1 {
 			fns[i], fns[j] = fns[j], fns[i]
@@ -392,16 +806,16 @@ func setupTestDBData(t *testing.T, dsn string) (teardown func()) {
 	return
 }
 
-func creaeteTestDBSchema(t *testing.T, config *connectorConfig) (clear func()) {
+func creaeteTestDBSchema(t *testing.T, config *Config) (clear func()) {
 	// space: BAR
 	// | FOO |
 	// |-----|
 	// | 1   |
 	// | 2   |
-	conn, err := tarantool.Connect(config.connStr,
+	conn, err := tarantool.Connect(config.Addr,
 		tarantool.Opts{
-			User: config.user,
-			Pass: config.pass,
+			User: config.User,
+			Pass: config.Password,
 		})
 	if err != nil {
 		t.Fatalf("unexpected error for tarantool.Connect: %v", err)
@@ -494,10 +908,10 @@ func creaeteTestDBSchema(t *testing.T, config *connectorConfig) (clear func()) {
 	}
 
 	clear = func() {
-		conn, err := tarantool.Connect(config.connStr,
+		conn, err := tarantool.Connect(config.Addr,
 			tarantool.Opts{
-				User: config.user,
-				Pass: config.pass,
+				User: config.User,
+				Pass: config.Password,
 			})
 		if err != nil {
 			return
@@ -510,11 +924,11 @@ func creaeteTestDBSchema(t *testing.T, config *connectorConfig) (clear func()) {
 	return
 }
 
-func insertTestDBValues(t *testing.T, config *connectorConfig) (clear func()) {
-	conn, err := tarantool.Connect(config.connStr,
+func insertTestDBValues(t *testing.T, config *Config) (clear func()) {
+	conn, err := tarantool.Connect(config.Addr,
 		tarantool.Opts{
-			User: config.user,
-			Pass: config.pass,
+			User: config.User,
+			Pass: config.Password,
 		})
 	if err != nil {
 		t.Fatalf("unexpected error for tarantool.Connect: %v", err)
@@ -0,0 +1,118 @@
+package tnt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+// ErrReadOnlyTransaction запрос на изменение данных в транзакции, начатой с ReadOnly: true
+var ErrReadOnlyTransaction = errors.New("write statement in read-only transaction")
+
+// Error ошибка, которую вернул сервер тарантула
+//
+// Достается через errors.As, для частых случаев есть хелперы IsDuplicateKey, IsTupleNotFound и т.п.
+// Коды ошибок - константы go-tarantool (tarantool.ErrTupleFound и т.д.)
+type Error struct {
+	Code    uint32 // код ошибки тарантула
+	Message string
+	SQL     string // запрос, при выполнении которого произошла ошибка, пустой для begin/commit/rollback
+
+	err error // исходная ошибка go-tarantool
+}
+
+func (e *Error) Error() string {
+	if e.SQL != "" {
+		return fmt.Sprintf("tarantool error: %s (0x%x), query: %s", e.Message, e.Code, e.SQL)
+	}
+	return fmt.Sprintf("tarantool error: %s (0x%x)", e.Message, e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Оборачивание серверной ошибки go-tarantool в Error, остальные ошибки возвращаются как есть
+func newError(err error, query string) error {
+	var tErr tarantool.Error
+	if !errors.As(err, &tErr) {
+		return err
+	}
+	return &Error{
+		Code:    tErr.Code,
+		Message: tErr.Msg,
+		SQL:     query,
+		err:     err,
+	}
+}
+
+// IsDuplicateKey нарушение уникального индекса
+func IsDuplicateKey(err error) bool {
+	return hasErrorCode(err, tarantool.ErrTupleFound)
+}
+
+// IsTupleNotFound кортеж не найден
+func IsTupleNotFound(err error) bool {
+	return hasErrorCode(err, tarantool.ErrTupleNotFound)
+}
+
+// IsTransactionConflict транзакция прервана из-за конфликта (mvcc)
+func IsTransactionConflict(err error) bool {
+	return hasErrorCode(err, tarantool.ErrTransactionConflict)
+}
+
+// IsReadOnly попытка изменить данные на инстансе в режиме read-only (в том числе на реплике)
+// или в read-only транзакции
+func IsReadOnly(err error) bool {
+	return errors.Is(err, ErrReadOnlyTransaction) || hasErrorCode(err, tarantool.ErrReadonly, tarantool.ErrNonmaster)
+}
+
+// ErrCodeTransactionTimeout код ER_TRANSACTION_TIMEOUT из errcode.h тарантула (есть с 2.10),
+// в go-tarantool v1 такой константы нет
+const ErrCodeTransactionTimeout uint32 = 255
+
+// IsTransactionTimeout транзакция прервана сервером по таймауту (tx_timeout или дедлайн контекста BeginTx)
+//
+// Сервер отдает ER_TRANSACTION_TIMEOUT на запросы и commit такой транзакции. Текст ошибки проверяется
+// только как запасной вариант, для ошибок go-tarantool, не завернутых в Error
+func IsTransactionTimeout(err error) bool {
+	if hasErrorCode(err, ErrCodeTransactionTimeout) {
+		return true
+	}
+	msg, ok := serverMessage(err)
+	return ok && msg == "Transaction has been aborted by timeout"
+}
+
+func hasErrorCode(err error, codes ...uint32) bool {
+	var tErr *Error
+	if !errors.As(err, &tErr) {
+		return false
+	}
+	for _, code := range codes {
+		if tErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Текст серверной ошибки, для ошибок, коды которых go-tarantool не экспортирует
+func serverMessage(err error) (string, bool) {
+	var tErr *Error
+	if errors.As(err, &tErr) {
+		return tErr.Message, true
+	}
+	var rawErr tarantool.Error
+	if errors.As(err, &rawErr) {
+		return rawErr.Msg, true
+	}
+	return "", false
+}
+
+// ER_WRONG_QUERY_ID: сервер не знает идентификатор подготовленного выражения
+func isWrongQueryID(err error) bool {
+	msg, ok := serverMessage(err)
+	return ok && strings.HasPrefix(msg, "Prepared statement with id ") && strings.HasSuffix(msg, " does not exist")
+}
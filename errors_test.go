@@ -0,0 +1,81 @@
+package tnt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+func TestNewError(t *testing.T) {
+	tErr := tarantool.Error{Code: tarantool.ErrTupleFound, Msg: `Duplicate key exists in unique index "pk_unnamed_Test_1" in space "Test"`}
+	err := fmt.Errorf("prepare error: %w", newError(tErr, `INSERT INTO "Test" VALUES (1, 'Alice')`))
+
+	var got *Error
+	if !errors.As(err, &got) {
+		t.Fatalf("errors.As failed for %v", err)
+	}
+	if got.Code != tarantool.ErrTupleFound || got.Message != tErr.Msg || got.SQL != `INSERT INTO "Test" VALUES (1, 'Alice')` {
+		t.Fatalf("error mismatch: %#v", got)
+	}
+	if !errors.Is(err, tErr) {
+		t.Error("original go-tarantool error is not unwrapped")
+	}
+	if newError(io.EOF, "") != io.EOF {
+		t.Error("non-server error must be returned as is")
+	}
+}
+
+func TestErrorHelpers(t *testing.T) {
+	tests := []struct {
+		code uint32
+		is   func(error) bool
+	}{
+		{code: tarantool.ErrTupleFound, is: IsDuplicateKey},
+		{code: tarantool.ErrTupleNotFound, is: IsTupleNotFound},
+		{code: tarantool.ErrTransactionConflict, is: IsTransactionConflict},
+		{code: tarantool.ErrReadonly, is: IsReadOnly},
+		{code: tarantool.ErrNonmaster, is: IsReadOnly},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.code), func(t *testing.T) {
+			err := newError(tarantool.Error{Code: tc.code}, "")
+			if !tc.is(fmt.Errorf("wrapped: %w", err)) {
+				t.Errorf("helper does not match code %d", tc.code)
+			}
+			if tc.is(newError(tarantool.Error{Code: tarantool.ErrUnknown}, "")) {
+				t.Errorf("helper matches unexpected code %d", tarantool.ErrUnknown)
+			}
+			if tc.is(nil) {
+				t.Error("helper matches nil error")
+			}
+		})
+	}
+}
+
+func TestIsWrongQueryID(t *testing.T) {
+	tErr := tarantool.Error{Code: tarantool.ErrUnknown, Msg: "Prepared statement with id 3952461442 does not exist"}
+	if !isWrongQueryID(tErr) || !isWrongQueryID(fmt.Errorf("prepare error: %w", newError(tErr, ""))) {
+		t.Errorf("isWrongQueryID does not match %v", tErr)
+	}
+	if isWrongQueryID(newError(tarantool.Error{Code: tarantool.ErrTupleFound, Msg: "Duplicate key exists"}, "")) || isWrongQueryID(io.EOF) {
+		t.Error("isWrongQueryID matches unexpected error")
+	}
+}
+
+func TestIsTransactionTimeout(t *testing.T) {
+	for _, err := range []error{
+		newError(tarantool.Error{Code: ErrCodeTransactionTimeout, Msg: "aborted"}, ""),
+		// запасная проверка по тексту
+		tarantool.Error{Code: tarantool.ErrUnknown, Msg: "Transaction has been aborted by timeout"},
+	} {
+		if !IsTransactionTimeout(fmt.Errorf("wrapped: %w", err)) {
+			t.Errorf("IsTransactionTimeout does not match %v", err)
+		}
+	}
+	if IsTransactionTimeout(newError(tarantool.Error{Code: tarantool.ErrTransactionConflict, Msg: "Transaction has been aborted by conflict"}, "")) || IsTransactionTimeout(nil) {
+		t.Error("IsTransactionTimeout matches unexpected error")
+	}
+}
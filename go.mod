@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/google/go-cmp v0.5.9
 	github.com/google/uuid v1.3.0
+	github.com/shopspring/decimal v1.3.1
 	github.com/tarantool/go-tarantool v1.10.0
 	golang.org/x/exp v0.0.0-20221217163422-3c43f8badb15
 )
@@ -12,7 +13,6 @@ require (
 require (
 	github.com/golang/protobuf v1.3.1 // indirect
 	github.com/mattn/go-pointer v0.0.1 // indirect
-	github.com/shopspring/decimal v1.3.1 // indirect
 	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572 // indirect
 	github.com/tarantool/go-openssl v0.0.8-0.20220711094538-d93c1eff4f49 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
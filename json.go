@@ -0,0 +1,114 @@
+package tnt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tarantool/go-tarantool/datetime"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
+)
+
+/*
+	Составные типы тарантула: MAP, ARRAY и ANY (может хранить что угодно, в том числе map и array)
+
+	Из rows значения таких колонок отдаются JSON'ом ([]byte), так их можно просканировать в []byte,
+	string, tnt.Map, tnt.Array или в произвольную структуру через tnt.JSON. Ключи map в msgpack могут быть
+	любого типа, в JSON они переводятся в строки, время - в RFC3339Nano, decimal - в число без потери точности.
+
+	В параметрах можно передавать Go map и слайсы (а также tnt.Map и tnt.Array), они уходят msgpack'ом как есть
+*/
+
+// Map значение MAP колонки
+type Map map[string]interface{}
+
+func (m *Map) Scan(src interface{}) error {
+	return scanJSON(src, m, "tnt.Map")
+}
+
+// Value отдает map как есть, драйвер передает его msgpack map'ом
+func (m Map) Value() (driver.Value, error) {
+	return map[string]interface{}(m), nil
+}
+
+// Array значение ARRAY колонки
+type Array []interface{}
+
+func (a *Array) Scan(src interface{}) error {
+	return scanJSON(src, a, "tnt.Array")
+}
+
+// Value отдает слайс как есть, драйвер передает его msgpack массивом
+func (a Array) Value() (driver.Value, error) {
+	return []interface{}(a), nil
+}
+
+// JSON сканер MAP, ARRAY и ANY колонок в произвольное значение через encoding/json
+//
+//	var meta struct{ Tags []string `json:"tags"` }
+//	err := row.Scan(tnt.JSON(&meta))
+func JSON(dest interface{}) sql.Scanner {
+	return jsonScanner{dest: dest}
+}
+
+type jsonScanner struct {
+	dest interface{}
+}
+
+func (s jsonScanner) Scan(src interface{}) error {
+	return scanJSON(src, s.dest, fmt.Sprintf("%T", s.dest))
+}
+
+// NULL оставляет dest без изменений
+func scanJSON(src, dest interface{}, typeName string) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("Scan: unable to scan type %T into %s", src, typeName)
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("Scan: %v", err)
+	}
+	return nil
+}
+
+// Составное значение из msgpack в JSON
+func marshalJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(jsonValue(v))
+}
+
+// Приведение значения к виду, который понимает encoding/json
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonValue(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = jsonValue(val)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, val := range v {
+			a[i] = jsonValue(val)
+		}
+		return a
+	case datetime.Datetime:
+		return v.ToTime()
+	case tntdecimal.Decimal:
+		return json.Number(v.String())
+	}
+	return v
+}
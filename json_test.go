@@ -0,0 +1,94 @@
+package tnt
+
+import (
+	"database/sql/driver"
+	"testing"
+	stdtime "time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tarantool/go-tarantool"
+	"github.com/tarantool/go-tarantool/datetime"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
+)
+
+func TestRowsNextJSON(t *testing.T) {
+	at, err := datetime.NewDatetime(stdtime.Date(2023, 1, 2, 3, 4, 5, 0, stdtime.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	price, err := tntdecimal.NewDecimalFromString("0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &rows{
+		data: []interface{}{[]interface{}{
+			map[interface{}]interface{}{
+				"tags":    []interface{}{"a", "b"},
+				uint64(1): map[interface{}]interface{}{"at": *at, "price": *price},
+			},
+			[]interface{}{int64(1), "two", nil},
+			int64(3), // ANY со скалярным значением
+		}},
+		cMetaData: []tarantool.ColumnMetaData{
+			{FieldName: "meta", FieldType: "map"},
+			{FieldName: "list", FieldType: "array"},
+			{FieldName: "any", FieldType: "any"},
+		},
+	}
+	dest := make([]driver.Value, 3)
+	if err := r.Next(dest); err != nil {
+		t.Fatalf("unexpected error for Next: %v", err)
+	}
+	want := []driver.Value{
+		[]byte(`{"1":{"at":"2023-01-02T03:04:05Z","price":0.1},"tags":["a","b"]}`),
+		[]byte(`[1,"two",null]`),
+		int64(3),
+	}
+	if !cmp.Equal(dest, want) {
+		t.Fatalf("value mismatch\nGot: %s\nWant: %s", dest, want)
+	}
+
+	var m Map
+	if err := m.Scan(dest[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(m["tags"], []interface{}{"a", "b"}) {
+		t.Errorf("tnt.Map mismatch: %v", m)
+	}
+	var a Array
+	if err := a.Scan(dest[1]); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(a, Array{float64(1), "two", nil}) {
+		t.Errorf("tnt.Array mismatch: %v", a)
+	}
+	var meta struct {
+		Tags []string `json:"tags"`
+	}
+	if err := JSON(&meta).Scan(dest[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(meta.Tags, []string{"a", "b"}) {
+		t.Errorf("tnt.JSON mismatch: %v", meta)
+	}
+	if err := JSON(&meta).Scan(int64(1)); err == nil {
+		t.Error("did not encounter expected error for int64")
+	}
+}
+
+func TestNativeValueNested(t *testing.T) {
+	at, err := datetime.NewDatetime(stdtime.Date(2023, 1, 2, 0, 0, 0, 0, stdtime.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nativeValue(Map{"at": *at, "list": Array{*at}})
+	want := map[string]interface{}{"at": at, "list": []interface{}{at}}
+	if !cmp.Equal(got, want, datetimeComparer) {
+		t.Errorf("value mismatch\nGot: %v\nWant: %v", got, want)
+	}
+	for _, v := range []interface{}{map[string]int{"a": 1}, []float64{1}, Map{}, Array{}} {
+		if err := checkNamedValue(&driver.NamedValue{Value: v}); err != nil {
+			t.Errorf("unexpected error for %T: %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package tnt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Лексер для Tarantool SQL
+
+	Нужен что бы находить в запросе настоящие параметры (?, :name и $1) и не путать их
+	с такими же символами внутри строковых литералов ('a?b'), идентификаторов в кавычках ("time:zone"),
+	комментариев (строчных и блочных) и т.п. Полноценный разбор SQL тут не нужен, поэтому лексер выдает
+	только грубые токены, пробелы и комментарии пропускаются.
+
+	Правила экранирования как в тарантуле: внутри литерала кавычка удваивается ('it''s', "a""b").
+	Незакрытый литерал или комментарий тянется до конца запроса, ошибку в таком случае вернет сервер
+*/
+
+type tokenKind int
+
+const (
+	tokenWord        tokenKind = iota // ключевое слово, идентификатор без кавычек или число
+	tokenQuoted                       // идентификатор в двойных кавычках
+	tokenString                       // строковый литерал
+	tokenPlaceholder                  // параметр запроса: ?, :name или $1
+	tokenPunct                        // все остальное, по одному символу (кроме ::)
+)
+
+type token struct {
+	kind tokenKind
+	pos  int    // смещение начала токена в байтах
+	end  int    // смещение конца токена в байтах (не включительно)
+	text string // текст токена, для :name - имя без двоеточия, для $1 - текст целиком
+}
+
+func tokenize(query string) []token {
+	tokens := make([]token, 0)
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += 2 + end + 2
+			}
+		case r == '\'':
+			end := quotedEnd(query, i)
+			tokens = append(tokens, token{kind: tokenString, pos: i, end: end, text: query[i:end]})
+			i = end
+		case r == '"':
+			end := quotedEnd(query, i)
+			tokens = append(tokens, token{kind: tokenQuoted, pos: i, end: end, text: query[i:end]})
+			i = end
+		case r == '?':
+			tokens = append(tokens, token{kind: tokenPlaceholder, pos: i, end: i + 1, text: "?"})
+			i++
+		case r == ':':
+			if strings.HasPrefix(query[i:], "::") {
+				tokens = append(tokens, token{kind: tokenPunct, pos: i, end: i + 2, text: "::"})
+				i += 2
+				continue
+			}
+			end := wordEnd(query, i+1)
+			if end == i+1 || !isNameStart(query[i+1:]) {
+				tokens = append(tokens, token{kind: tokenPunct, pos: i, end: i + 1, text: ":"})
+				i++
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenPlaceholder, pos: i, end: end, text: query[i+1 : end]})
+			i = end
+		case r == '$' && isOrdinalStart(query, i):
+			end := digitsEnd(query, i+1)
+			tokens = append(tokens, token{kind: tokenPlaceholder, pos: i, end: end, text: query[i:end]})
+			i = end
+		case isWordRune(r):
+			end := wordEnd(query, i)
+			tokens = append(tokens, token{kind: tokenWord, pos: i, end: end, text: query[i:end]})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: tokenPunct, pos: i, end: i + size, text: query[i : i+size]})
+			i += size
+		}
+	}
+	return tokens
+}
+
+// Конец литерала, начинающегося с кавычки в позиции start, удвоенная кавычка - экранирование
+func quotedEnd(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+func wordEnd(query string, start int) int {
+	i := start
+	for i < len(query) {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		if !isWordRune(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// $ с цифрой после него - порядковый параметр, если только $ не часть идентификатора (a$1)
+func isOrdinalStart(query string, i int) bool {
+	if i+1 >= len(query) || !isDigit(query[i+1]) {
+		return false
+	}
+	prev, _ := utf8.DecodeLastRuneInString(query[:i])
+	return i == 0 || !isWordRune(prev)
+}
+
+func digitsEnd(query string, start int) int {
+	i := start
+	for i < len(query) && isDigit(query[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Имя параметра не может начинаться с цифры
+func isNameStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// Является ли токен ключевым словом kw (без учета регистра)
+func (t token) is(kw string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, kw)
+}
@@ -0,0 +1,107 @@
+package tnt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenizePlaceholders(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantPos   []int
+		wantNames []string
+	}{
+		{
+			input:     `SELECT * FROM "test" WHERE "id"=? AND "name"=:name`,
+			wantPos:   []int{32, 45},
+			wantNames: []string{"?", "name"},
+		},
+		{
+			input: `SELECT 'a?b', 'it''s :x' FROM "time:zone" WHERE "a""?" = 1`,
+		},
+		{
+			input:     "SELECT 1 -- where id = ?\nFROM \"test\" WHERE \"id\" = ?",
+			wantPos:   []int{50},
+			wantNames: []string{"?"},
+		},
+		{
+			input:     `SELECT /* :skip ? */ "a" FROM "test" WHERE "id" = :id_1`,
+			wantPos:   []int{50},
+			wantNames: []string{"id_1"},
+		},
+		{
+			input: `SELECT "a"::INTEGER, x : 1, :1 FROM "test"`,
+		},
+		{
+			input:     `SELECT * FROM "тест" WHERE "имя"=:имя`,
+			wantPos:   []int{40},
+			wantNames: []string{"имя"},
+		},
+		{
+			input:     `SELECT * FROM "test" WHERE "id"=$1 AND "a$2"=$12 AND a$3 = '$4'`,
+			wantPos:   []int{32, 45},
+			wantNames: []string{"$1", "$12"},
+		},
+		{
+			input: `SELECT 'unterminated ?`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var gotPos []int
+			var gotNames []string
+			for _, tok := range tokenize(tc.input) {
+				if tok.kind == tokenPlaceholder {
+					gotPos = append(gotPos, tok.pos)
+					gotNames = append(gotNames, tok.text)
+				}
+			}
+			if !cmp.Equal(gotPos, tc.wantPos) || !cmp.Equal(gotNames, tc.wantNames) {
+				t.Errorf("placeholders mismatch for %q\nGot: %v %v\nWant: %v %v", tc.input, gotPos, gotNames, tc.wantPos, tc.wantNames)
+			}
+		})
+	}
+}
+
+// Произвольный текст, помещенный в литерал, идентификатор или комментарий,
+// не должен давать параметров, единственный параметр - ? после него
+func FuzzTokenizeLiterals(f *testing.F) {
+	for _, seed := range []string{"", "?", ":id", "$1", "a?b", "'", `"`, "''?", "--?", "/*?*/", "*/ ?", "\n?"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		comment := s
+		for strings.Contains(comment, "*/") {
+			comment = strings.ReplaceAll(comment, "*/", "")
+		}
+		queries := []string{
+			`SELECT '` + strings.ReplaceAll(s, `'`, `''`) + `' FROM "t" WHERE "id" = ?`,
+			`SELECT "` + strings.ReplaceAll(s, `"`, `""`) + `" FROM "t" WHERE "id" = ?`,
+			`SELECT 1 -- ` + strings.ReplaceAll(s, "\n", " ") + "\nFROM \"t\" WHERE \"id\" = ?",
+			`SELECT /* ` + comment + ` */ 1 FROM "t" WHERE "id" = ?`,
+		}
+		for _, q := range queries {
+			var placeholders []token
+			for _, tok := range tokenize(q) {
+				if tok.kind == tokenPlaceholder {
+					placeholders = append(placeholders, tok)
+				}
+			}
+			if len(placeholders) != 1 || placeholders[0].pos != len(q)-1 {
+				t.Fatalf("placeholders mismatch for %q: %v", q, placeholders)
+			}
+		}
+
+		// на произвольном запросе лексер не падает и отдает корректные позиции
+		for _, tok := range tokenize(s) {
+			if tok.pos < 0 || tok.end > len(s) || tok.pos >= tok.end {
+				t.Fatalf("bad token bounds for %q: %v", s, tok)
+			}
+			if tok.kind == tokenPlaceholder && s[tok.pos] != '?' && s[tok.pos] != ':' && s[tok.pos] != '$' {
+				t.Fatalf("placeholder does not start with ?, : or $ for %q: %v", s, tok)
+			}
+		}
+	})
+}
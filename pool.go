@@ -0,0 +1,165 @@
+package tnt
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+/*
+	Пул физических соединений коннектора
+
+	Каждое "внутреннее" соединение database/sql при открытии получает один из PoolSize слотов
+	(по кругу, с предпочтением живых соединений) и мультиплексирует свои запросы через его
+	tarantool соединение. Слот подключается лениво, если подключение не удалось - ошибка отдается
+	наружу, а следующая попытка снова пойдет на сервер, так что упавший один раз сервер
+	не ломает коннектор до конца жизни процесса. Закрытое соединение (например, после исчерпания
+	попыток переподключения) также переоткрывается при следующем обращении к слоту.
+
+	Физическое соединение закрывается, когда его отпускает последнее использующее его
+	"внутреннее" соединение
+*/
+
+type pool struct {
+	mu    sync.Mutex
+	slots []*poolSlot
+	next  int
+}
+
+type poolSlot struct {
+	mu   sync.Mutex
+	conn *tarantool.Connection
+	refs int
+
+	// закрывается по окончании подключения, nil если слот сейчас не подключается
+	dialing chan struct{}
+
+	// счетчики ссылок на подготовленные выражения, см. retainPrepared
+	prepared map[preparedKey]int
+}
+
+type preparedKey struct {
+	conn *tarantool.Connection
+	id   tarantool.PreparedID
+}
+
+func newPool(size int) *pool {
+	if size <= 0 {
+		size = 1
+	}
+	p := &pool{slots: make([]*poolSlot, size)}
+	for i := range p.slots {
+		p.slots[i] = &poolSlot{}
+	}
+	return p
+}
+
+// Выбор слота: идем по кругу начиная со следующего, берем первый с живым соединением,
+// если таких нет - слот по очереди, который будет (пере)подключен
+func (p *pool) pick() *poolSlot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.next
+	p.next = (p.next + 1) % len(p.slots)
+	for i := 0; i < len(p.slots); i++ {
+		s := p.slots[(start+i)%len(p.slots)]
+		s.mu.Lock()
+		healthy := s.conn != nil && s.conn.ConnectedNow()
+		s.mu.Unlock()
+		if healthy {
+			return s
+		}
+	}
+	return p.slots[start]
+}
+
+// Получение слота с подключенным соединением
+//
+// Подключение идет без блокировки слота, так что зависший dial не мешает pick и остальным слотам.
+// Если слот уже подключает другая горутина, ждем ее результата, пока не истечет ctx
+func (p *pool) acquire(ctx context.Context, c *connector) (*poolSlot, error) {
+	s := p.pick()
+	for {
+		s.mu.Lock()
+		if s.conn != nil && !s.conn.ClosedNow() {
+			s.refs++
+			s.mu.Unlock()
+			return s, nil
+		}
+		if wait := s.dialing; wait != nil {
+			s.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		s.dialing = done
+		s.mu.Unlock()
+
+		conn, err := c.dial(ctx)
+
+		s.mu.Lock()
+		s.dialing = nil
+		close(done)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.conn = conn
+		s.prepared = nil
+		s.refs++
+		s.mu.Unlock()
+		return s, nil
+	}
+}
+
+// Возврат слота, соединение закрывается вместе с уходом последнего пользователя
+func (p *pool) release(s *poolSlot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs--
+	if s.refs > 0 || s.conn == nil {
+		return nil
+	}
+	conn := s.conn
+	s.conn = nil
+	return conn.Close()
+}
+
+/*
+	Подготовленные выражения тарантул хранит в сессии, а одинаковый текст запроса в одной сессии
+	получает тот же id без счетчика ссылок. Сессию (физическое соединение слота) делят несколько
+	"внутренних" соединений, поэтому unprepare можно отправлять только когда выражение
+	не использует больше ни один stmt, иначе оно пропало бы у всех остальных
+*/
+
+// Учет stmt, использующего подготовленное выражение
+func (s *poolSlot) retainPrepared(p *tarantool.Prepared) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prepared == nil {
+		s.prepared = make(map[preparedKey]int)
+	}
+	s.prepared[preparedKey{conn: p.Conn, id: p.StatementID}]++
+}
+
+// Освобождение выражения stmt'ом, last = true если других пользователей у него нет
+// (в том числе если соединение слота уже переоткрыто и выражение не учитывается)
+func (s *poolSlot) releasePrepared(p *tarantool.Prepared) (last bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := preparedKey{conn: p.Conn, id: p.StatementID}
+	if s.prepared[key] > 1 {
+		s.prepared[key]--
+		return false
+	}
+	delete(s.prepared, key)
+	return true
+}
@@ -0,0 +1,91 @@
+package tnt
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+// Result результат выполнения DML запроса с идентификаторами,
+// которые тарантул сгенерировал для AUTOINCREMENT полей
+type Result interface {
+	driver.Result
+	// AutoincrementIDs все сгенерированные идентификаторы (для INSERT с несколькими строками)
+	AutoincrementIDs() []uint64
+}
+
+var _ Result = &result{}
+
+type result struct {
+	rowsAffected     int64
+	lastInsertId     int64
+	autoincrementIDs []uint64
+}
+
+func newResult(info tarantool.SQLInfo) *result {
+	r := &result{
+		rowsAffected:     int64(info.AffectedCount),
+		autoincrementIDs: info.InfoAutoincrementIds,
+	}
+	if n := len(info.InfoAutoincrementIds); n > 0 {
+		r.lastInsertId = int64(info.InfoAutoincrementIds[n-1])
+	}
+	return r
+}
+
+// LastInsertId последний сгенерированный идентификатор, 0 если запрос ничего не генерировал
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+func (r *result) AutoincrementIDs() []uint64 {
+	return r.autoincrementIDs
+}
+
+// ExecContext выполняет запрос на соединении и возвращает Result со всеми сгенерированными идентификаторами
+//
+// sql.Result, который отдает database/sql, оборачивает результат драйвера, поэтому до
+// AutoincrementIDs через db.ExecContext не добраться, для этого и нужен хелпер:
+//
+//	conn, _ := db.Conn(ctx)
+//	defer conn.Close()
+//	res, err := tnt.ExecContext(ctx, conn, `INSERT INTO "T" ("name") VALUES (?), (?)`, "a", "b")
+//	ids := res.AutoincrementIDs()
+func ExecContext(ctx context.Context, c *sql.Conn, query string, args ...interface{}) (Result, error) {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nvs[i].Ordinal = i + 1
+		if na, ok := a.(sql.NamedArg); ok {
+			nvs[i].Name = na.Name
+			a = na.Value
+		}
+		nvs[i].Value = a
+		if err := checkNamedValue(&nvs[i]); err != nil {
+			return nil, err
+		}
+	}
+	var res Result
+	err := c.Raw(func(driverConn interface{}) error {
+		dc, ok := driverConn.(*conn)
+		if !ok {
+			return errors.New("not a tnt connection")
+		}
+		r, err := dc.ExecContext(ctx, query, nvs)
+		if err != nil {
+			return err
+		}
+		res = r.(Result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+package tnt
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tarantool/go-tarantool"
+)
+
+func TestNewResult(t *testing.T) {
+	tests := []struct {
+		name             string
+		info             tarantool.SQLInfo
+		wantRowsAffected int64
+		wantLastInsertId int64
+		wantIDs          []uint64
+	}{
+		{
+			name:             "no autoincrement",
+			info:             tarantool.SQLInfo{AffectedCount: 2},
+			wantRowsAffected: 2,
+		},
+		{
+			name:             "multi row insert",
+			info:             tarantool.SQLInfo{AffectedCount: 3, InfoAutoincrementIds: []uint64{7, 8, 10}},
+			wantRowsAffected: 3,
+			wantLastInsertId: 10,
+			wantIDs:          []uint64{7, 8, 10},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newResult(tc.info)
+			if got, _ := r.RowsAffected(); got != tc.wantRowsAffected {
+				t.Errorf("rows affected mismatch\nGot: %v\nWant: %v", got, tc.wantRowsAffected)
+			}
+			if got, _ := r.LastInsertId(); got != tc.wantLastInsertId {
+				t.Errorf("last insert id mismatch\nGot: %v\nWant: %v", got, tc.wantLastInsertId)
+			}
+			if got := r.AutoincrementIDs(); !cmp.Equal(got, tc.wantIDs) {
+				t.Errorf("autoincrement ids mismatch\nGot: %v\nWant: %v", got, tc.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package tnt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TxOptions параметры транзакции для RunInTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	// сколько раз выполнять транзакцию при конфликтах, 0 - 10 раз
+	MaxAttempts int
+	// пауза перед повтором номер attempt (начиная с 1), nil - ExponentialBackoff(10ms, 1s, 0.5)
+	Backoff func(attempt int) time.Duration
+}
+
+const defaultMaxAttempts = 10
+
+var defaultBackoff = ExponentialBackoff(10*time.Millisecond, time.Second, 0.5)
+
+// RunInTx выполняет fn в транзакции и повторяет ее, если она прервана MVCC конфликтом
+//
+// Если fn вернула ошибку, транзакция откатывается, иначе коммитится. При конфликте (IsTransactionConflict,
+// в fn или на commit) транзакция выполняется заново после паузы opts.Backoff, пока не кончатся попытки
+// или контекст. fn может вызываться несколько раз, поэтому не должна иметь побочных эффектов вне транзакции
+//
+//	err := tnt.RunInTx(ctx, db, nil, func(tx *sql.Tx) error {
+//		_, err := tx.ExecContext(ctx, `UPDATE "accounts" SET "balance" = "balance" - ? WHERE "id" = ?`, sum, id)
+//		return err
+//	})
+func RunInTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(tx *sql.Tx) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, txOpts, fn)
+		if err == nil || !IsTransactionConflict(err) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("transaction conflict after %d attempts: %w", attempt, err)
+		}
+		timer := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("transaction retry stopped: %v: %w", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Одна попытка: begin, fn, commit или rollback
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// ExponentialBackoff экспоненциальная пауза: base, 2*base, 4*base... но не больше limit
+//
+// jitter (от 0 до 1) - доля паузы, выбираемая случайно, что бы конфликтующие транзакции
+// не повторялись одновременно: при 0.5 пауза случайна в диапазоне [d/2, d]
+func ExponentialBackoff(base, limit time.Duration, jitter float64) func(attempt int) time.Duration {
+	if jitter > 1 {
+		jitter = 1
+	}
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < limit; i++ {
+			d *= 2
+		}
+		if d > limit {
+			d = limit
+		}
+		random := time.Duration(jitter * float64(d))
+		if random <= 0 {
+			return d
+		}
+		jitterMu.Lock()
+		defer jitterMu.Unlock()
+		return d - random + time.Duration(jitterRand.Int63n(int64(random)+1))
+	}
+}
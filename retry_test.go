@@ -0,0 +1,117 @@
+package tnt
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+// Драйвер-заглушка, commit которого возвращает конфликт, пока не кончится conflicts
+type conflictDriver struct {
+	conflicts int
+	commits   int
+	rollbacks int
+}
+
+func (d *conflictDriver) Open(string) (driver.Conn, error) { return conflictConn{d}, nil }
+
+// Коннектор для sql.OpenDB, что бы не регистрировать драйвер глобально (sql.Register нельзя вызвать дважды)
+type conflictConnector struct{ d *conflictDriver }
+
+func (c conflictConnector) Connect(context.Context) (driver.Conn, error) { return conflictConn(c), nil }
+func (c conflictConnector) Driver() driver.Driver                        { return c.d }
+
+type conflictConn struct{ d *conflictDriver }
+
+func (c conflictConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (c conflictConn) Close() error                        { return nil }
+func (c conflictConn) Begin() (driver.Tx, error)           { return conflictTx(c), nil }
+
+type conflictTx struct{ d *conflictDriver }
+
+func (tx conflictTx) Commit() error {
+	tx.d.commits++
+	if tx.d.conflicts > 0 {
+		tx.d.conflicts--
+		return newError(tarantool.Error{Code: tarantool.ErrTransactionConflict, Msg: "Transaction has been aborted by conflict"}, "")
+	}
+	return nil
+}
+
+func (tx conflictTx) Rollback() error {
+	tx.d.rollbacks++
+	return nil
+}
+
+func openConflictDB(t *testing.T, conflicts int) (*sql.DB, *conflictDriver) {
+	d := &conflictDriver{conflicts: conflicts}
+	db := sql.OpenDB(conflictConnector{d})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+func TestRunInTxRetriesConflicts(t *testing.T) {
+	db, d := openConflictDB(t, 2)
+	calls := 0
+	opts := &TxOptions{Backoff: func(int) time.Duration { return 0 }}
+	err := RunInTx(context.Background(), db, opts, func(*sql.Tx) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for RunInTx: %v", err)
+	}
+	if calls != 3 || d.commits != 3 {
+		t.Fatalf("attempts mismatch: calls %d, commits %d, want 3", calls, d.commits)
+	}
+}
+
+func TestRunInTxGivesUp(t *testing.T) {
+	db, d := openConflictDB(t, 100)
+	opts := &TxOptions{MaxAttempts: 3, Backoff: func(int) time.Duration { return 0 }}
+	err := RunInTx(context.Background(), db, opts, func(*sql.Tx) error { return nil })
+	if !IsTransactionConflict(err) || d.commits != 3 {
+		t.Fatalf("unexpected result: %v after %d commits", err, d.commits)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts = &TxOptions{Backoff: func(int) time.Duration { cancel(); return time.Hour }}
+	err = RunInTx(ctx, db, opts, func(*sql.Tx) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error for canceled context\nGot: %v\nWant: %v", err, context.Canceled)
+	}
+}
+
+func TestRunInTxDoesNotRetryOtherErrors(t *testing.T) {
+	db, d := openConflictDB(t, 0)
+	errFn := errors.New("fn failed")
+	calls := 0
+	err := RunInTx(context.Background(), db, nil, func(*sql.Tx) error {
+		calls++
+		return errFn
+	})
+	if !errors.Is(err, errFn) || calls != 1 || d.rollbacks != 1 || d.commits != 0 {
+		t.Fatalf("unexpected result: %v, calls %d, rollbacks %d, commits %d", err, calls, d.rollbacks, d.commits)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	fixed := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond, 0)
+	for attempt, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := fixed(attempt + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", attempt+1, got, want*time.Millisecond)
+		}
+	}
+	jittered := ExponentialBackoff(100*time.Millisecond, time.Second, 0.5)
+	for i := 0; i < 100; i++ {
+		if got := jittered(2); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("jittered backoff %v is out of [100ms, 200ms]", got)
+		}
+	}
+}
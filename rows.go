@@ -1,10 +1,14 @@
 package tnt
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"strings"
 
 	"github.com/aeroideaservices/tnt/time"
 	"github.com/google/uuid"
@@ -21,14 +25,223 @@ type rows struct {
 	data      []interface{} // данные, приходящие из тарантула через библиотеку go-tarantool
 	cMetaData []tarantool.ColumnMetaData
 	isClosed  bool
+
+	// в cMetaData заполнены поля полных метаданных (nullable, collation и т.д.), см. full_metadata в dsn
+	fullMetadata bool
+
+	// постраничная выборка (см. WithFetchSize), fetch == nil когда страниц больше нет,
+	// last - последняя строка полученной страницы, от нее отсчитывается следующая
+	fetch     func(last []interface{}) (*tarantool.Response, error)
+	fetchSize int
+	last      []interface{}
 }
 
 func (r *rows) Close() error {
 	r.data = nil
+	r.fetch = nil
+	r.last = nil
 	r.isClosed = true
 	return nil
 }
 
+type fetchSizeKey struct{}
+
+// WithFetchSize включает для запросов с этим контекстом постраничное чтение результата SELECT
+// по n строк (перекрывает параметр fetch_size из dsn, n = 0 выключает постраничное чтение)
+//
+// Следующая страница запрашивается лениво в rows.Next, поэтому в памяти одновременно
+// находится не больше n строк. Страницы выбираются по ключам ORDER BY верхнего уровня
+// (условием "ключ больше последнего прочитанного"), поэтому ключи должны быть колонками
+// результата и вместе однозначно определять строку, например первичный ключ. Запросы без
+// ORDER BY, с LIMIT/OFFSET или сортировкой по выражениям читаются целиком
+func WithFetchSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchSizeKey{}, n)
+}
+
+// Ключ сортировки для постраничного чтения
+type orderKey struct {
+	name    string // имя колонки в результате
+	collate string // COLLATE из ORDER BY как есть, пустая строка если не задан
+	desc    bool
+}
+
+// Колонка ключа в запросах следующих страниц (они ссылаются на колонки подзапроса)
+func (k orderKey) column() string {
+	if k.collate == "" {
+		return quoteIdent(k.name)
+	}
+	return quoteIdent(k.name) + " COLLATE " + k.collate
+}
+
+// Постраничное чтение по ключам сортировки (keyset): первая страница - исходный запрос с LIMIT,
+// следующие выбираются условием на ключи последней прочитанной строки, так что сервер
+// не перечитывает предыдущие страницы, как было бы с OFFSET
+type keyset struct {
+	query string // исходный запрос без завершающих ; и комментариев
+	inner string // запрос без ORDER BY верхнего уровня
+	keys  []orderKey
+}
+
+// Разбор запроса для постраничного чтения, false если запрос нельзя читать по ключам:
+// нет ORDER BY верхнего уровня, есть LIMIT/OFFSET или сортировка не по колонкам
+func parseKeyset(query string) (*keyset, bool) {
+	tokens := tokenize(query)
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 || !tokens[0].is("SELECT") {
+		return nil, false
+	}
+	depth, orderAt := 0, -1
+	for i, t := range tokens {
+		switch {
+		case t.kind == tokenPunct && t.text == "(":
+			depth++
+		case t.kind == tokenPunct && t.text == ")":
+			depth--
+		case depth != 0:
+		case t.is("LIMIT") || t.is("OFFSET"):
+			return nil, false
+		case t.is("ORDER") && i+1 < len(tokens) && tokens[i+1].is("BY"):
+			orderAt = i
+		}
+	}
+	if orderAt == -1 {
+		return nil, false
+	}
+	keys, ok := parseOrderKeys(tokens[orderAt+2:])
+	if !ok {
+		return nil, false
+	}
+	return &keyset{
+		query: query[tokens[0].pos:tokens[len(tokens)-1].end],
+		inner: query[tokens[0].pos:tokens[orderAt-1].end],
+		keys:  keys,
+	}, true
+}
+
+// Разбор списка ORDER BY, поддерживаются только колонки: id, t.id, "t"."id" [COLLATE c] [ASC|DESC]
+func parseOrderKeys(tokens []token) ([]orderKey, bool) {
+	var keys []orderKey
+	for i := 0; ; i++ {
+		if i >= len(tokens) || !isIdent(tokens[i]) {
+			return nil, false
+		}
+		key := orderKey{name: identName(tokens[i])}
+		i++
+		if i+1 < len(tokens) && tokens[i].kind == tokenPunct && tokens[i].text == "." && isIdent(tokens[i+1]) {
+			key.name = identName(tokens[i+1])
+			i += 2
+		}
+		if i+1 < len(tokens) && tokens[i].is("COLLATE") {
+			key.collate = tokens[i+1].text
+			i += 2
+		}
+		if i < len(tokens) && (tokens[i].is("ASC") || tokens[i].is("DESC")) {
+			key.desc = tokens[i].is("DESC")
+			i++
+		}
+		keys = append(keys, key)
+		if i == len(tokens) {
+			return keys, true
+		}
+		if tokens[i].kind != tokenPunct || tokens[i].text != "," {
+			return nil, false
+		}
+	}
+}
+
+// Идентификатор (а не число, литерал и т.п.)
+func isIdent(t token) bool {
+	return t.kind == tokenQuoted || t.kind == tokenWord && isNameStart(t.text)
+}
+
+// Имя колонки, как его вернет сервер: без кавычек регистр приводится к верхнему
+func identName(t token) string {
+	if t.kind == tokenQuoted {
+		return strings.ReplaceAll(strings.TrimSuffix(t.text[1:], `"`), `""`, `"`)
+	}
+	return strings.ToUpper(t.text)
+}
+
+// Запрос первой страницы, LIMIT передается последним аргументом
+func (k *keyset) firstQuery() string {
+	return k.query + " LIMIT ?"
+}
+
+// Запрос следующей страницы: (k1 > ?) OR (k1 = ? AND k2 > ?) OR ..., для DESC сравнение обратное.
+// Аргументы - nextArgs и LIMIT
+func (k *keyset) nextQuery() string {
+	cond := make([]string, len(k.keys))
+	order := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		terms := make([]string, 0, i+1)
+		for _, prev := range k.keys[:i] {
+			terms = append(terms, prev.column()+" = ?")
+		}
+		if key.desc {
+			terms = append(terms, key.column()+" < ?")
+			order[i] = key.column() + " DESC"
+		} else {
+			terms = append(terms, key.column()+" > ?")
+			order[i] = key.column()
+		}
+		cond[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return "SELECT * FROM (" + k.inner + ") WHERE " + strings.Join(cond, " OR ") +
+		" ORDER BY " + strings.Join(order, ", ") + " LIMIT ?"
+}
+
+// Аргументы условия nextQuery по значениям ключей последней прочитанной строки
+func (k *keyset) nextArgs(values []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(values)*(len(values)+1)/2)
+	for i := range values {
+		args = append(args, values[:i+1]...)
+	}
+	return args
+}
+
+// Номера колонок ключей в результате, false если какой-то ключ не найден или неоднозначен
+func (k *keyset) columns(meta []tarantool.ColumnMetaData) ([]int, bool) {
+	idx := make([]int, len(k.keys))
+	for i, key := range k.keys {
+		idx[i] = -1
+		for j, m := range meta {
+			if m.FieldName != key.name {
+				continue
+			}
+			if idx[i] != -1 {
+				return nil, false
+			}
+			idx[i] = j
+		}
+		if idx[i] == -1 {
+			return nil, false
+		}
+	}
+	return idx, true
+}
+
+// Учет полученной страницы, неполная страница - последняя
+func (r *rows) paged(data []interface{}) {
+	if len(data) < r.fetchSize {
+		r.fetch = nil
+		return
+	}
+	r.last, _ = data[len(data)-1].([]interface{})
+}
+
+// Запрос следующей страницы
+func (r *rows) fetchNext() error {
+	resp, err := r.fetch(r.last)
+	if err != nil {
+		return err
+	}
+	r.data = resp.Data
+	r.paged(resp.Data)
+	return nil
+}
+
 func (r *rows) Columns() []string {
 	c := make([]string, len(r.cMetaData))
 	for i, m := range r.cMetaData {
@@ -37,11 +250,71 @@ func (r *rows) Columns() []string {
 	return c
 }
 
+// Типы колонок, иплементация интерфейсов
+// https://pkg.go.dev/database/sql/driver@go1.20.1#RowsColumnTypeDatabaseTypeName и соседних
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.cMetaData[index].FieldType)
+}
+
+// Тип, в который гарантированно сканируется значение колонки (соответствует тому, что отдает Next)
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch strings.ToLower(r.cMetaData[index].FieldType) {
+	case "integer":
+		return reflect.TypeOf(int64(0))
+	case "unsigned":
+		return reflect.TypeOf(uint64(0))
+	case "double":
+		return reflect.TypeOf(float64(0))
+	case "boolean":
+		return reflect.TypeOf(false)
+	case "string", "uuid":
+		return reflect.TypeOf("")
+	case "varbinary":
+		return reflect.TypeOf(Blob{})
+	case "decimal":
+		return reflect.TypeOf(Decimal{})
+	case "datetime":
+		return reflect.TypeOf(datetime.Datetime{})
+	case "interval":
+		return reflect.TypeOf(time.Interval{})
+	case "map":
+		return reflect.TypeOf(Map{})
+	case "array":
+		return reflect.TypeOf(Array{})
+	default:
+		// number, scalar, any и т.п. могут хранить значения разных типов
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+}
+
+// Информация о nullable есть только в полных метаданных (full_metadata=true в dsn)
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if !r.fullMetadata {
+		return false, false
+	}
+	return r.cMetaData[index].FieldIsNullable, true
+}
+
+// Строки и бинарные данные в тарантуле не ограничены по длине
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	switch strings.ToLower(r.cMetaData[index].FieldType) {
+	case "string", "varbinary":
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
 // проход по кортежам
 func (r *rows) Next(dest []driver.Value) error {
 	if r.isClosed {
 		return errors.New("Next called after Close")
 	}
+	if len(r.data) == 0 && r.fetch != nil {
+		if err := r.fetchNext(); err != nil {
+			return err
+		}
+	}
 	if len(r.data) > 0 {
 		// забираем 1 кортеж из набора
 		row, ok := r.data[0].([]interface{})
@@ -64,6 +337,18 @@ func (r *rows) Next(dest []driver.Value) error {
 				dest[i] = v.Int()
 			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 				dest[i] = v.Uint()
+			case reflect.Map, reflect.Slice:
+				if b, ok := row[i].([]byte); ok {
+					// varbinary, копируем, что бы значение не зависело от буфера ответа
+					dest[i] = append([]byte(nil), b...)
+					break
+				}
+				// MAP, ARRAY и ANY с составным значением отдаем JSON'ом (см. json.go)
+				data, err := marshalJSON(row[i])
+				if err != nil {
+					return fmt.Errorf("can't convert column %q to json: %w", r.cMetaData[i].FieldName, err)
+				}
+				dest[i] = data
 			default:
 				// сложные типы
 				switch reflect.TypeOf(row[i]) {
@@ -84,6 +369,13 @@ func (r *rows) Next(dest []driver.Value) error {
 						return errors.New("wrong datetime type assertion")
 					}
 					dest[i] = val
+				case reflect.TypeOf(datetime.Interval{}):
+					// сканируется в time.Interval или datetime.Interval
+					val, ok := row[i].(datetime.Interval)
+					if !ok {
+						return errors.New("wrong interval type assertion")
+					}
+					dest[i] = val
 				case reflect.TypeOf(time.Time{}):
 					// кастомный тип-обртка для datetime тарантула, имплементирующий интерфейс сканера
 					val, ok := row[i].(time.Time)
@@ -92,12 +384,13 @@ func (r *rows) Next(dest []driver.Value) error {
 					}
 					dest[i] = val.ToTime().Format(time.RFC3339Nano)
 				case reflect.TypeOf(decimal.Decimal{}):
-					// тип для поддержки float тарантула
+					// отдаем строкой без потери точности, database/sql сам сконвертирует ее
+					// в string, float64 или tnt.Decimal
 					val, ok := row[i].(decimal.Decimal)
 					if !ok {
 						return errors.New("wrong dacimal type assertion")
 					}
-					dest[i] = val
+					dest[i] = val.String()
 				}
 			}
 
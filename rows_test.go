@@ -0,0 +1,187 @@
+package tnt
+
+import (
+	"database/sql/driver"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/tarantool/go-tarantool"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
+)
+
+func TestParseKeyset(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantFirst string
+		wantNext  string
+	}{
+		{
+			input:     "SELECT \"id\" FROM \"test\" ORDER BY \"id\";\n",
+			wantFirst: `SELECT "id" FROM "test" ORDER BY "id" LIMIT ?`,
+			wantNext:  `SELECT * FROM (SELECT "id" FROM "test") WHERE ("id" > ?) ORDER BY "id" LIMIT ?`,
+		},
+		{
+			input:     `select t.a, b from t -- комментарий` + "\n" + `order by t.a desc, b collate "unicode_ci"`,
+			wantFirst: `select t.a, b from t -- комментарий` + "\n" + `order by t.a desc, b collate "unicode_ci" LIMIT ?`,
+			wantNext: `SELECT * FROM (select t.a, b from t) WHERE ("A" < ?) OR ("A" = ? AND "B" COLLATE "unicode_ci" > ?)` +
+				` ORDER BY "A" DESC, "B" COLLATE "unicode_ci" LIMIT ?`,
+		},
+		{
+			input:     `SELECT * FROM (SELECT "id" FROM "a" ORDER BY "id" LIMIT 10) ORDER BY "id"`,
+			wantFirst: `SELECT * FROM (SELECT "id" FROM "a" ORDER BY "id" LIMIT 10) ORDER BY "id" LIMIT ?`,
+			wantNext:  `SELECT * FROM (SELECT * FROM (SELECT "id" FROM "a" ORDER BY "id" LIMIT 10)) WHERE ("id" > ?) ORDER BY "id" LIMIT ?`,
+		},
+		// читаются целиком
+		{input: `SELECT * FROM "test"`},
+		{input: `SELECT * FROM "test" ORDER BY "id" LIMIT 10`},
+		{input: `SELECT * FROM "test" ORDER BY 1`},
+		{input: `SELECT * FROM "test" ORDER BY "a" + "b"`},
+		{input: `SELECT * FROM (SELECT * FROM "test" ORDER BY "id")`},
+		{input: `SELECTED "id" ORDER BY "id"`},
+		{input: `INSERT INTO "test" SELECT * FROM "other" ORDER BY "id"`},
+		{input: ``},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			ks, ok := parseKeyset(tc.input)
+			if ok != (tc.wantFirst != "") {
+				t.Fatalf("parseKeyset mismatch for %q\nGot: %v\nWant: %v", tc.input, ok, !ok)
+			}
+			if !ok {
+				return
+			}
+			if got := ks.firstQuery(); got != tc.wantFirst {
+				t.Errorf("first page query mismatch\nGot: %v\nWant: %v", got, tc.wantFirst)
+			}
+			if got := ks.nextQuery(); got != tc.wantNext {
+				t.Errorf("next page query mismatch\nGot: %v\nWant: %v", got, tc.wantNext)
+			}
+		})
+	}
+}
+
+func TestKeysetArgs(t *testing.T) {
+	ks, _ := parseKeyset(`SELECT * FROM "t" ORDER BY "a", "b", "c"`)
+	got := ks.nextArgs([]interface{}{1, 2, 3})
+	want := []interface{}{1, 1, 2, 1, 2, 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("next page args mismatch\nGot: %v\nWant: %v", got, want)
+	}
+
+	idx, ok := ks.columns([]tarantool.ColumnMetaData{{FieldName: "c"}, {FieldName: "x"}, {FieldName: "b"}, {FieldName: "a"}})
+	if !ok || !reflect.DeepEqual(idx, []int{3, 2, 0}) {
+		t.Errorf("key columns mismatch\nGot: %v, %v\nWant: [3 2 0], true", idx, ok)
+	}
+	if _, ok := ks.columns([]tarantool.ColumnMetaData{{FieldName: "a"}, {FieldName: "b"}}); ok {
+		t.Error("missing key column must not be found")
+	}
+	if _, ok := ks.columns([]tarantool.ColumnMetaData{{FieldName: "a"}, {FieldName: "b"}, {FieldName: "c"}, {FieldName: "a"}}); ok {
+		t.Error("ambiguous key column must not be found")
+	}
+}
+
+func TestRowsNextPaged(t *testing.T) {
+	const total, fetchSize = 5, 2
+	var lasts []interface{}
+	fetch := func(last []interface{}) (*tarantool.Response, error) {
+		from := int64(0)
+		if last != nil {
+			lasts = append(lasts, last[0])
+			from = last[0].(int64) + 1
+		}
+		r := &tarantool.Response{}
+		for i := from; i < total && i < from+fetchSize; i++ {
+			r.Data = append(r.Data, []interface{}{i})
+		}
+		return r, nil
+	}
+	first, _ := fetch(nil)
+	r := &rows{
+		data:      first.Data,
+		cMetaData: []tarantool.ColumnMetaData{{FieldName: "id"}},
+		fetch:     fetch,
+		fetchSize: fetchSize,
+	}
+	r.paged(first.Data)
+
+	dest := make([]driver.Value, 1)
+	for want := int64(0); want < total; want++ {
+		if err := r.Next(dest); err != nil {
+			t.Fatalf("unexpected error for Next: %v", err)
+		}
+		if dest[0] != want {
+			t.Fatalf("value mismatch\nGot: %v\nWant: %v", dest[0], want)
+		}
+	}
+	if err := r.Next(dest); err != io.EOF {
+		t.Fatalf("unexpected error for Next after last row\nGot: %v\nWant: %v", err, io.EOF)
+	}
+	if !reflect.DeepEqual(lasts, []interface{}{int64(1), int64(3)}) {
+		t.Fatalf("fetch last rows mismatch: %v", lasts)
+	}
+}
+
+func TestRowsColumnTypes(t *testing.T) {
+	r := &rows{
+		cMetaData: []tarantool.ColumnMetaData{
+			{FieldName: "id", FieldType: "integer"},
+			{FieldName: "name", FieldType: "string", FieldCollation: "unicode_ci", FieldIsNullable: true},
+			{FieldName: "value", FieldType: "scalar", FieldIsNullable: true},
+			{FieldName: "price", FieldType: "decimal", FieldIsNullable: true},
+		},
+		fullMetadata: true,
+	}
+	tests := []struct {
+		wantTypeName string
+		wantScanType reflect.Type
+		wantNullable bool
+		wantLength   int64
+		wantLengthOk bool
+	}{
+		{wantTypeName: "INTEGER", wantScanType: reflect.TypeOf(int64(0))},
+		{wantTypeName: "STRING", wantScanType: reflect.TypeOf(""), wantNullable: true, wantLength: math.MaxInt64, wantLengthOk: true},
+		{wantTypeName: "SCALAR", wantScanType: reflect.TypeOf((*interface{})(nil)).Elem(), wantNullable: true},
+		{wantTypeName: "DECIMAL", wantScanType: reflect.TypeOf(Decimal{}), wantNullable: true},
+	}
+	for i, tc := range tests {
+		t.Run(r.cMetaData[i].FieldName, func(t *testing.T) {
+			if got := r.ColumnTypeDatabaseTypeName(i); got != tc.wantTypeName {
+				t.Errorf("type name mismatch\nGot: %v\nWant: %v", got, tc.wantTypeName)
+			}
+			if got := r.ColumnTypeScanType(i); got != tc.wantScanType {
+				t.Errorf("scan type mismatch\nGot: %v\nWant: %v", got, tc.wantScanType)
+			}
+			if got, ok := r.ColumnTypeNullable(i); got != tc.wantNullable || !ok {
+				t.Errorf("nullable mismatch\nGot: %v, %v\nWant: %v, true", got, ok, tc.wantNullable)
+			}
+			if got, ok := r.ColumnTypeLength(i); got != tc.wantLength || ok != tc.wantLengthOk {
+				t.Errorf("length mismatch\nGot: %v, %v\nWant: %v, %v", got, ok, tc.wantLength, tc.wantLengthOk)
+			}
+		})
+	}
+
+	r.fullMetadata = false
+	if _, ok := r.ColumnTypeNullable(1); ok {
+		t.Error("nullable must be unknown without full metadata")
+	}
+}
+
+func TestRowsNextDecimal(t *testing.T) {
+	price, err := tntdecimal.NewDecimalFromString("1234567890.0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &rows{
+		data:      []interface{}{[]interface{}{*price}},
+		cMetaData: []tarantool.ColumnMetaData{{FieldName: "price", FieldType: "decimal"}},
+	}
+	dest := make([]driver.Value, 1)
+	if err := r.Next(dest); err != nil {
+		t.Fatalf("unexpected error for Next: %v", err)
+	}
+	if dest[0] != "1234567890.0123456789" {
+		t.Fatalf("value mismatch\nGot: %#v\nWant: %v", dest[0], "1234567890.0123456789")
+	}
+}
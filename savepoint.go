@@ -0,0 +1,68 @@
+package tnt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+	Точки сохранения внутри транзакции
+
+	database/sql не знает про savepoint'ы, поэтому они сделаны функциями поверх *sql.Tx,
+	запросы SAVEPOINT/ROLLBACK TO/RELEASE уходят в стрим транзакции как обычные запросы.
+	WithSavepoint эмулирует вложенные транзакции, так что хелперы, открывающие "свою" транзакцию,
+	можно вызывать внутри чужой
+*/
+
+// Savepoint создает точку сохранения name в транзакции tx
+func Savepoint(ctx context.Context, tx *sql.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+quoteIdent(name))
+	return err
+}
+
+// RollbackToSavepoint откатывает изменения транзакции tx до точки сохранения name, сама точка остается
+func RollbackToSavepoint(ctx context.Context, tx *sql.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+quoteIdent(name))
+	return err
+}
+
+// ReleaseSavepoint удаляет точку сохранения name (и все созданные после нее), изменения остаются в транзакции
+func ReleaseSavepoint(ctx context.Context, tx *sql.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+quoteIdent(name))
+	return err
+}
+
+var savepointSeq uint64
+
+// WithSavepoint выполняет fn как вложенную транзакцию внутри tx
+//
+// Перед fn создается точка сохранения с уникальным именем. Если fn вернула ошибку или запаниковала,
+// изменения откатываются до точки, иначе точка освобождается. Вызовы можно вкладывать друг в друга.
+// Ошибка fn возвращается как есть, внешняя транзакция остается открытой в любом случае
+func WithSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) (err error) {
+	name := fmt.Sprintf("tnt_savepoint_%d", atomic.AddUint64(&savepointSeq, 1))
+	if err := Savepoint(ctx, tx, name); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = RollbackToSavepoint(ctx, tx, name)
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		if rbErr := RollbackToSavepoint(ctx, tx, name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint: %v)", err, rbErr)
+		}
+		return err
+	}
+	return ReleaseSavepoint(ctx, tx, name)
+}
+
+// Имя в двойных кавычках, кавычки внутри удваиваются
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,16 @@
+package tnt
+
+import "testing"
+
+func TestQuoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"sp":       `"sp"`,
+		`a"; DROP`: `"a""; DROP"`,
+		"точка_1":  `"точка_1"`,
+	}
+	for name, want := range tests {
+		if got := quoteIdent(name); got != want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
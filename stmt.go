@@ -2,34 +2,40 @@ package tnt
 
 import (
 	"context"
-	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
-
-	"unicode"
-	"unicode/utf8"
+	stdtime "time"
 
 	"github.com/aeroideaservices/tnt/time"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"github.com/tarantool/go-tarantool"
 	"github.com/tarantool/go-tarantool/datetime"
+	tntdecimal "github.com/tarantool/go-tarantool/decimal"
 	_ "github.com/tarantool/go-tarantool/uuid"
 	"golang.org/x/exp/slices"
 )
 
 type stmt struct {
-	conn        *conn
-	stream      *tarantool.Stream
-	numArgs     int
-	rawQuery    string // не модифицированный sql запрос
-	query       string // sql запрос с кастами
-	pa          sync.Once
-	argsBuilded bool
-	args        []arg
+	conn     *conn
+	stream   *tarantool.Stream
+	numArgs  int
+	rawQuery string // не модифицированный sql запрос
+	query    string // sql запрос с кастами
+	pa       sync.Once
+	args     []arg
+	parseErr error // ошибка разбора параметров (например, смешаны стили), отдается при выполнении
+
+	// подготовленные на сервере выражения, ключ - итоговый запрос (после кастов),
+	// nil для обычных (не подготовленных через conn.PrepareContext) выражений
+	prepared map[string]*tarantool.Prepared
 }
 
 func NewStmt(conn *conn, rawQuery string, stream *tarantool.Stream) *stmt {
@@ -41,72 +47,221 @@ func NewStmt(conn *conn, rawQuery string, stream *tarantool.Stream) *stmt {
 	}
 }
 
-func (s *stmt) resetQuery() {
-	s.query = s.rawQuery
+// Закрытие выражения, все подготовленные на сервере варианты запроса освобождаются
+//
+// unprepare уходит только для выражений, которые не использует ни один другой stmt той же
+// сессии (см. poolSlot.retainPrepared)
+func (s *stmt) Close() error {
+	var err error
+	for query, p := range s.prepared {
+		delete(s.prepared, query)
+		if !s.conn.slot.releasePrepared(p) || p.Conn.ClosedNow() {
+			continue
+		}
+		_, uErr := p.Conn.Do(tarantool.NewUnprepareRequest(p)).Get()
+		// после переподключения сессия новая и выражения в ней уже нет
+		if uErr != nil && !isWrongQueryID(uErr) && err == nil {
+			err = fmt.Errorf("unprepare error: %w", uErr)
+		}
+	}
+	return err
 }
 
-func (s *stmt) Close() error {
+// Подготовка запроса на сервере, результат кладется в кэш выражения
+func (s *stmt) prepare(ctx context.Context, query string) error {
+	ctx, cancel := s.conn.connector.requestContext(ctx)
+	defer cancel()
+	resp, err := await(ctx, s.conn.tConn.Do(tarantool.NewPrepareRequest(query).Context(ctx)))
+	if err != nil {
+		return fmt.Errorf("prepare error: %w", newError(err, query))
+	}
+	p, err := tarantool.NewPreparedFromResponse(s.conn.tConn, resp)
+	if err != nil {
+		return fmt.Errorf("prepare error: %w", err)
+	}
+	if s.prepared == nil {
+		s.prepared = make(map[string]*tarantool.Prepared)
+	}
+	if old, ok := s.prepared[query]; ok {
+		s.conn.slot.releasePrepared(old)
+	}
+	s.conn.slot.retainPrepared(p)
+	s.prepared[query] = p
 	return nil
 }
 
+// Фактическое выполнение запроса
+//
+// Для подготовленного выражения используется идентификатор с сервера, если же касты изменили
+// текст запроса, то такой вариант подготавливается отдельно и тоже кэшируется. Варианты
+// с раскрытыми списками IN отправляются текстом: на каждую длину списка пришлось бы держать
+// на сервере отдельное выражение до закрытия stmt. Обычные выражения просто отправляются текстом
+//
+// Если сервер не знает идентификатор (go-tarantool переподключился и сессия новая), запрос
+// подготавливается заново и выполняется еще раз - до выполнения дело не дошло, так что повтор безопасен
+//
+// Запрос уходит вместе с контекстом (и timeout из конфига, см. requestContext), так что при его отмене
+// или истечении дедлайна go-tarantool сам снимает ожидание ответа
+func (s *stmt) execute(ctx context.Context, query string, tArgs []interface{}) (*tarantool.Response, error) {
+	ctx, cancel := s.conn.connector.requestContext(ctx)
+	defer cancel()
+	if s.prepared == nil || s.expandsList() {
+		return s.do(ctx, tarantool.NewExecuteRequest(query).Args(tArgs).Context(ctx))
+	}
+	p, ok := s.prepared[query]
+	if !ok {
+		if err := s.prepare(ctx, query); err != nil {
+			return nil, err
+		}
+		p = s.prepared[query]
+	}
+	r, err := s.do(ctx, tarantool.NewExecutePreparedRequest(p).Args(tArgs).Context(ctx))
+	if err == nil || !isWrongQueryID(err) {
+		return r, err
+	}
+	if err := s.prepare(ctx, query); err != nil {
+		return nil, err
+	}
+	return s.do(ctx, tarantool.NewExecutePreparedRequest(s.prepared[query]).Args(tArgs).Context(ctx))
+}
+
+// Отправка запроса: в транзакции через ее stream, иначе напрямую
+//
+// Подготовленное выражение не привязано к транзакции: database/sql (Tx.StmtContext) выполняет в транзакции
+// и выражения, подготовленные на том же соединении до BeginTx, поэтому текущая транзакция
+// соединения определяется при каждом выполнении
+func (s *stmt) do(ctx context.Context, req tarantool.Request) (*tarantool.Response, error) {
+	stream := s.stream
+	if stream == nil {
+		if t := s.conn.currentTx(); t != nil {
+			stream = t.stream
+		}
+	}
+	if stream != nil {
+		return await(ctx, stream.Do(req))
+	}
+	return await(ctx, s.conn.tConn.Do(req))
+}
+
+// Проверка запроса текущей транзакцией соединения (read-only), для выражений, выполняемых
+// через tx, проверку уже сделал tx.ExecContext/QueryContext
+func (s *stmt) checkTx() error {
+	if s.stream != nil {
+		return nil
+	}
+	if t := s.conn.currentTx(); t != nil {
+		return t.check(s.rawQuery)
+	}
+	return nil
+}
+
+// Ожидание ответа на запрос, отправленный с контекстом
+//
+// При отмене контекста go-tarantool завершает future ошибкой "context is done",
+// наружу же отдаем привычную ctx.Err(), что бы работали errors.Is(err, context.Canceled) и т.п.
+func await(ctx context.Context, fut *tarantool.Future) (*tarantool.Response, error) {
+	r, err := fut.Get()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return r, err
+}
+
 func (s *stmt) NumInput() int {
 	s.parseArgs()
+	if s.parseErr != nil {
+		// пусть database/sql не проверяет количество, ошибку вернет bindArgs
+		return -1
+	}
 	return s.numArgs
 }
 
 /*
 	Алогитм работы с аргументами
 
-	Кастомные типы (время, uuid и т.п.) не проходят сами по себе и требуют CAST в самом запросе
+	UUID, время и decimal передаются в тарантул msgpack расширениями (go-tarantool их регистрирует),
+	так что текст запроса не зависит от типов значений и подготовленное выражение переиспользуется
+	с любыми аргументами. Для старых версий тарантула, не принимающих расширения в SQL параметрах,
+	есть режим cast_params: значения передаются строкой и в запрос вставляется CAST
 	(https://www.tarantool.io/ru/doc/latest/reference/reference_sql/sql_statements_and_clauses/#cast)
-	для простоты использования мы не хотим заставлять людей прописывать касты вручную,
-	для этого следующий ход модифицирует sql запрос автоматически
 
-	1. (parseArgs) Нужно пропарсить аргументы в запросе, именованные (:id) и неименованные (?)
+	1. (parseArgs) Нужно пропарсить аргументы в запросе, именованные (:id), неименованные (?)
+	и порядковые в стиле PostgreSQL ($1), которые генерируют sqlc, squirrel и т.п.
+	Порядковые параметры берут значение по Ordinal, могут повторяться и в запросе заменяются на ?,
+	смешивать их с ? и :name в одном запросе нельзя
 
 	2. (buildArgs) Теперь мы проходимся по пришешим к нам параметрам, которые мы хотим "поставить" на место ?,
-	сверяемся, что все норм по количеству/именам, через reflect определяем их тип и решаем, нужно ли
-	их кастить прямым образом (через CAST)
+	сверяемся, что все норм по количеству/именам, в режиме cast_params через reflect определяем их тип
+	и решаем, нужно ли их кастить прямым образом (через CAST)
+
+	Один и тот же именованный параметр может встречаться в запросе несколько раз (WHERE a = :id OR b = :id),
+	значение для него передается один раз, а CAST (если нужен) ставится на каждое вхождение
+
+	Слайс, переданный единственным параметром в IN (? или :ids), раскрывается в список
+	IN (?, ?, ?) по одному параметру на элемент, пустой слайс - ошибка, т.к. IN () тарантул не принимает,
+	а подстановка NULL молча ломает NOT IN. Слайс в любом другом месте передается как есть (msgpack массив)
 
 	3. (modifyQuery) Последовательно проходимся по аргументам и вставляем CAST и нужный тип прямо в sql запрос
 
 	4. (makeArgs) Теперь уже преобразуем входные аргументы в нужный вид, который можно скормить функции из go-tarantool
 */
 
+// Все шаги работы с аргументами разом, результат - аргументы для go-tarantool, запрос с кастами в s.query
+func (s *stmt) bindArgs(args []driver.NamedValue) ([]interface{}, error) {
+	args = slices.Clone(args)
+	slices.SortFunc(args, func(a, b driver.NamedValue) bool {
+		return a.Ordinal < b.Ordinal
+	})
+	err := s.buildArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("build args error: %w", err)
+	}
+	s.modifyQuery()
+	return s.makeArgs(args), nil
+}
+
+// Разбор ошибки выполнения запроса (см. conn.checkErr)
+//
+// Параметры из io.Reader читаются в CheckNamedValue один раз, а на driver.ErrBadConn database/sql
+// повторил бы запрос с уже прочитанным reader'ом, то есть с пустыми данными. Поэтому для таких
+// запросов наружу отдается исходная ошибка, а соединение просто помечается сломанным
+func (s *stmt) checkErr(err error, args []driver.NamedValue) error {
+	if cErr := s.conn.checkErr(err); !errors.Is(cErr, driver.ErrBadConn) || !hasReaderArgs(args) {
+		return cErr
+	}
+	return err
+}
+
+func hasReaderArgs(args []driver.NamedValue) bool {
+	for _, a := range args {
+		if _, ok := a.Value.(readerData); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
 	return nil, errors.New("use ExecContext instead")
 }
 
 func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	s.resetQuery()
-
-	err := s.buildArgs(args)
-	if err != nil {
-		return nil, fmt.Errorf("build args error: %w", err)
-	}
-	err = s.modifyQuery(args)
-	if err != nil {
-		return nil, fmt.Errorf("modify query error: %w", err)
+	if err := s.checkTx(); err != nil {
+		return nil, err
 	}
-	tArgs, err := makeArgs(args)
+	tArgs, err := s.bindArgs(args)
 	if err != nil {
 		return nil, err
 	}
 	// фактичесоке выполнение запроса
-	var r *tarantool.Response
-	if s.stream != nil { // проверка на то, что мы находимся в транзакции
-		req := tarantool.NewExecuteRequest(s.query).Args(tArgs)
-		r, err = s.stream.Do(req).Get()
-	} else {
-		r, err = s.conn.tConn.Execute(s.query, tArgs)
-	}
+	r, err := s.execute(ctx, s.query, tArgs)
 	if err != nil {
-		return nil, err
+		return nil, s.checkErr(newError(err, s.query), args)
 	}
 	if r.Error != "" {
-		return nil, fmt.Errorf("tarantool error: %w", errors.New(r.Error))
+		return nil, &Error{Code: r.Code, Message: r.Error, SQL: s.query}
 	}
-	return &result{rowsAffected: int64(r.SQLInfo.AffectedCount)}, nil
+	return newResult(r.SQLInfo), nil
 }
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
@@ -114,39 +269,96 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	s.resetQuery()
-	err := s.buildArgs(args)
-	if err != nil {
-		return nil, fmt.Errorf("build args error: %w", err)
-	}
-	err = s.modifyQuery(args)
-	if err != nil {
-		return nil, fmt.Errorf("modify query error: %w", err)
+	if err := s.checkTx(); err != nil {
+		return nil, err
 	}
-	tArgs, err := makeArgs(args)
+	tArgs, err := s.bindArgs(args)
 	if err != nil {
 		return nil, err
 	}
-	var r *tarantool.Response
-	// фактичесоке выполнение запроса
-	if s.stream != nil { // проверка на то, что мы находимся в транзакции
-		req := tarantool.NewExecuteRequest(s.query).Args(tArgs)
-		r, err = s.stream.Do(req).Get()
-	} else {
-		r, err = s.conn.tConn.Execute(s.query, tArgs)
+	fetchSize := s.conn.connector.config.FetchSize
+	if size, ok := ctx.Value(fetchSizeKey{}).(int); ok {
+		fetchSize = size
 	}
+	if fetchSize > 0 {
+		// без ORDER BY порядок страниц не определен, такие запросы читаются целиком
+		if ks, ok := parseKeyset(s.query); ok {
+			return s.queryPaged(ctx, args, tArgs, ks, fetchSize)
+		}
+	}
+	return s.queryAll(ctx, args, tArgs)
+}
+
+// Выполнение запроса с чтением всего результата
+func (s *stmt) queryAll(ctx context.Context, args []driver.NamedValue, tArgs []interface{}) (driver.Rows, error) {
+	// фактичесоке выполнение запроса
+	r, err := s.execute(ctx, s.query, tArgs)
 	if err != nil {
-		return nil, err
+		return nil, s.checkErr(newError(err, s.query), args)
 	}
 	if r.Error != "" {
-		return nil, fmt.Errorf("tarantool error: %w", errors.New(r.Error))
+		return nil, &Error{Code: r.Code, Message: r.Error, SQL: s.query}
 	}
 	return &rows{
-		data:      r.Data,
-		cMetaData: r.MetaData,
+		data:         r.Data,
+		cMetaData:    r.MetaData,
+		fullMetadata: s.conn.connector.config.FullMetadata,
 	}, nil
 }
 
+// Постраничное выполнение SELECT (см. WithFetchSize)
+//
+// Размер страницы и значения ключей передаются последними неименованными аргументами,
+// так что текст запроса один для всех страниц и подготовленное выражение переиспользуется.
+// Первая страница запрашивается сразу, остальные - по мере чтения в rows.Next
+func (s *stmt) queryPaged(ctx context.Context, args []driver.NamedValue, tArgs []interface{}, ks *keyset, fetchSize int) (driver.Rows, error) {
+	run := func(query string, pageArgs []interface{}) (*tarantool.Response, error) {
+		r, err := s.execute(ctx, query, pageArgs)
+		if err != nil {
+			return nil, s.checkErr(newError(err, query), args)
+		}
+		if r.Error != "" {
+			return nil, &Error{Code: r.Code, Message: r.Error, SQL: query}
+		}
+		return r, nil
+	}
+	r, err := run(ks.firstQuery(), append(tArgs[:len(tArgs):len(tArgs)], fetchSize))
+	if err != nil {
+		return nil, err
+	}
+	rs := &rows{
+		data:         r.Data,
+		cMetaData:    r.MetaData,
+		fullMetadata: s.conn.connector.config.FullMetadata,
+		fetchSize:    fetchSize,
+	}
+	if len(r.Data) < fetchSize {
+		return rs, nil
+	}
+	idx, ok := ks.columns(r.MetaData)
+	if !ok {
+		// ключа сортировки нет среди колонок результата, следующую страницу не выбрать
+		return s.queryAll(ctx, args, tArgs)
+	}
+	query := ks.nextQuery()
+	rs.fetch = func(last []interface{}) (*tarantool.Response, error) {
+		values := make([]interface{}, len(idx))
+		for i, j := range idx {
+			if j >= len(last) {
+				return nil, errors.New("bad type assertion, want []interface{}")
+			}
+			if last[j] == nil {
+				return nil, fmt.Errorf("tnt: can't fetch next page: ORDER BY key %s is NULL", ks.keys[i].name)
+			}
+			values[i] = last[j]
+		}
+		pageArgs := append(tArgs[:len(tArgs):len(tArgs)], ks.nextArgs(values)...)
+		return run(query, append(pageArgs, fetchSize))
+	}
+	rs.paged(r.Data)
+	return rs, nil
+}
+
 func (s *stmt) CheckNamedValue(value *driver.NamedValue) error {
 	return checkNamedValue(value)
 }
@@ -154,68 +366,84 @@ func (s *stmt) CheckNamedValue(value *driver.NamedValue) error {
 const (
 	TypeUnnamed = iota
 	TypeNamed
+	TypeOrdinal
 )
 
 // вспомогательная структура для работы с аргументами
 type arg struct {
-	pos      int    // позиция в запросе (модифицируется при модификации запроса)
-	_type    int    // тип аргумента (именованный/неименованный)
-	name     string // имя (пустая строка при отсутствии)
+	pos      int    // позиция в исходном запросе в байтах
+	_type    int    // тип аргумента (именованный/неименованный/порядковый)
+	name     string // имя (пустая строка при отсутствии), для порядкового - номер как в запросе
+	ordinal  int    // номер порядкового параметра ($1 - 1)
 	castable bool   // требует ли каста в тарантуле
 	castType string // название тарантул-типа в который нужно кастить
+	value    int    // индекс значения среди аргументов запроса (заполняется в buildArgs)
+	inList   bool   // параметр - единственный элемент списка IN (...)
+	items    int    // количество элементов слайса, раскрываемого в список IN, 0 если не раскрывается
 }
 
+// Поиск параметров в запросе, литералы и комментарии пропускаются (см. lexer.go)
+//
+// numArgs - количество значений, которое нужно передать: каждый ? плюс уникальные имена,
+// для порядковых параметров - наибольший номер
 func (s *stmt) parseArgs() {
 	s.pa.Do(func() {
-		q := strings.Clone(s.rawQuery)
 		s.args = make([]arg, 0)
-		var isName bool
-		var name strings.Builder
-		for i := 0; len(q) > 0; i++ {
-			r, size := utf8.DecodeRuneInString(q)
-			if isName {
-				if unicode.IsLetter(r) || unicode.IsDigit(r) {
-					name.WriteRune(r)
-					q = q[size:]
-					continue
+		names := make(map[string]bool)
+		tokens := tokenize(s.rawQuery)
+		ordinals := 0
+		for i, t := range tokens {
+			if t.kind != tokenPlaceholder {
+				continue
+			}
+			a := arg{pos: t.pos, _type: TypeUnnamed, inList: isInList(tokens, i)}
+			if strings.HasPrefix(t.text, "$") {
+				a._type = TypeOrdinal
+				a.name = t.text[1:]
+				a.ordinal, _ = strconv.Atoi(a.name)
+				if a.ordinal == 0 && s.parseErr == nil {
+					s.parseErr = fmt.Errorf("invalid parameter %s", t.text)
 				}
-				s.args[len(s.args)-1].name = name.String()
-				name.Reset()
-				isName = !isName
+				ordinals++
+				s.args = append(s.args, a)
+				if a.ordinal > s.numArgs {
+					s.numArgs = a.ordinal
+				}
+				continue
 			}
-			switch {
-			case r == '?':
-				s.args = append(s.args, arg{
-					pos:   i,
-					_type: TypeUnnamed,
-				})
-			case r == ':':
-				isName = true
-				s.args = append(s.args, arg{
-					pos:   i,
-					_type: TypeNamed,
-				})
+			if t.text != "?" {
+				a._type = TypeNamed
+				a.name = t.text
+				if names[a.name] {
+					s.args = append(s.args, a)
+					continue
+				}
+				names[a.name] = true
 			}
-			q = q[size:]
+			s.args = append(s.args, a)
+			s.numArgs++
+		}
+		if ordinals > 0 && ordinals != len(s.args) && s.parseErr == nil {
+			s.parseErr = errors.New("mixing $N placeholders with ? or :name in one query is not supported")
 		}
-		s.numArgs = len(s.args)
 	})
 }
 
-func (s *stmt) buildArgs(sqlArgs []driver.NamedValue) error {
-	if s.argsBuilded {
-		return nil
-	}
-	args := slices.Clone(sqlArgs)
-	if s.args == nil {
-		s.parseArgs()
+// Стоит ли параметр tokens[i] в списке IN один: IN (?)
+func isInList(tokens []token, i int) bool {
+	return i >= 2 && i+1 < len(tokens) &&
+		tokens[i-2].is("IN") && tokens[i-1].text == "(" && tokens[i+1].text == ")"
+}
+
+// Сопоставление параметров запроса с переданными значениями (отсортированными по Ordinal)
+func (s *stmt) buildArgs(args []driver.NamedValue) error {
+	if s.NumInput(); s.parseErr != nil {
+		return s.parseErr
 	}
-	if len(s.args) != len(args) {
-		return fmt.Errorf("not enough parameters for query want %d have %d", len(s.args), len(args))
+	if want := s.NumInput(); want != len(args) {
+		return fmt.Errorf("not enough parameters for query want %d have %d", want, len(args))
 	}
-	slices.SortFunc(args, func(a, b driver.NamedValue) bool {
-		return a.Ordinal < b.Ordinal
-	})
+	used := make([]bool, len(args))
 	for i := 0; i < len(s.args); i++ {
 		var idx int
 		switch s.args[i]._type {
@@ -226,80 +454,243 @@ func (s *stmt) buildArgs(sqlArgs []driver.NamedValue) error {
 			if idx == -1 {
 				return fmt.Errorf("no parameter with name %s", s.args[i].name)
 			}
-		case TypeUnnamed:
+		case TypeOrdinal:
 			idx = slices.IndexFunc(args, func(v driver.NamedValue) bool {
-				return v.Name == ""
+				return v.Ordinal == s.args[i].ordinal
 			})
+			if idx == -1 {
+				return fmt.Errorf("no parameter %s", s.args[i].placeholder())
+			}
+		case TypeUnnamed:
+			idx = -1
+			for j := range args {
+				if args[j].Name == "" && !used[j] {
+					idx = j
+					break
+				}
+			}
 			if idx == -1 {
 				return fmt.Errorf("not enough unnamed parameters")
 			}
 		}
-		switch v := args[idx].Value; reflect.TypeOf(v) {
-		case reflect.TypeOf(uuid.UUID{}), reflect.TypeOf(&uuid.UUID{}):
-			s.args[i].castable = true
-			s.args[i].castType = "UUID"
-		case reflect.TypeOf(time.Time{}), reflect.TypeOf(&time.Time{}):
-			s.args[i].castable = true
-			s.args[i].castType = "DATETIME"
-		case reflect.TypeOf(datetime.Datetime{}), reflect.TypeOf(&datetime.Datetime{}):
-			s.args[i].castable = true
-			s.args[i].castType = "DATETIME"
-		default:
-			s.args[i].castable = false
-		}
-		/*
-			todo: в текущей реализации есть проблема, именованные параметры можно использовать только один раз
-		*/
-		args = append(args[:idx], args[idx+1:]...)
-	}
-	s.argsBuilded = true
+		used[idx] = true
+		s.args[i].value = idx
+		s.args[i].items = 0
+		t := reflect.TypeOf(args[idx].Value)
+		if s.args[i].inList && isExpandable(t) {
+			s.args[i].items = reflect.ValueOf(args[idx].Value).Len()
+			if s.args[i].items == 0 {
+				return fmt.Errorf("empty slice for IN parameter %s", s.args[i].placeholder())
+			}
+			t = t.Elem()
+		}
+		s.args[i].castType = ""
+		if s.castParams() {
+			s.args[i].castType = castTypeOf(t)
+		}
+		s.args[i].castable = s.args[i].castType != ""
+	}
 	return nil
 }
 
-func (s *stmt) modifyQuery(args []driver.NamedValue) error {
-	if !s.argsBuilded {
-		err := s.buildArgs(args)
-		if err != nil {
-			return err
+// Раскрыт ли в текущем выполнении какой-нибудь список IN (текст запроса зависит от длины слайсов)
+func (s *stmt) expandsList() bool {
+	for _, a := range s.args {
+		if a.items > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Раскрывать в список IN можно любой слайс, кроме []byte (это varbinary значение)
+func isExpandable(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+// Включен ли режим cast_params (см. описание алгоритма выше)
+func (s *stmt) castParams() bool {
+	return s.conn != nil && s.conn.connector.config.CastParams
+}
+
+// Тарантул-тип, в который нужно кастить значение типа t (режим cast_params), пустая строка - каст не нужен
+func castTypeOf(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(uuid.UUID{}), reflect.TypeOf(&uuid.UUID{}):
+		return "UUID"
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(&time.Time{}):
+		return "DATETIME"
+	case reflect.TypeOf(datetime.Datetime{}), reflect.TypeOf(&datetime.Datetime{}):
+		return "DATETIME"
+	}
+	return ""
+}
+
+// Параметр в том виде, в каком он записан в запросе
+func (a arg) placeholder() string {
+	switch a._type {
+	case TypeNamed:
+		return ":" + a.name
+	case TypeOrdinal:
+		return "$" + a.name
+	}
+	return "?"
+}
+
+// Вставка кастов в запрос, исходный запрос не меняется, результат в s.query
+func (s *stmt) modifyQuery() {
+	var newQuery strings.Builder
+	last := 0
+	for _, a := range s.args {
+		if !a.castable && a.items == 0 && a._type != TypeOrdinal {
+			continue
+		}
+		newQuery.WriteString(s.rawQuery[last:a.pos])
+		if a.items > 0 {
+			// раскрытый слайс всегда передается позиционно, в том числе для :name
+			for i := 0; i < a.items; i++ {
+				if i > 0 {
+					newQuery.WriteString(", ")
+				}
+				writeParam(&newQuery, "?", a.castType)
+			}
+		} else if a._type == TypeOrdinal {
+			// тарантул не знает $1, порядковый параметр передается позиционно
+			writeParam(&newQuery, "?", a.castType)
+		} else {
+			writeParam(&newQuery, a.placeholder(), a.castType)
 		}
+		last = a.pos + len(a.placeholder())
+	}
+	newQuery.WriteString(s.rawQuery[last:])
+	s.query = newQuery.String()
+}
+
+func writeParam(b *strings.Builder, placeholder, castType string) {
+	if castType == "" {
+		b.WriteString(placeholder)
+		return
+	}
+	fmt.Fprintf(b, "CAST(%s AS %s)", placeholder, castType)
+}
+
+// Аргументы для go-tarantool в порядке первого появления параметров в запросе
+//
+// Тарантул нумерует параметры по порядку, повторное вхождение имени получает тот же номер,
+// поэтому значение именованного параметра передается только один раз
+func (s *stmt) makeArgs(args []driver.NamedValue) []interface{} {
+	convert := nativeValue
+	if s.castParams() {
+		convert = covertValueForCustomTypes
 	}
-	for i := 0; i < s.NumInput(); i++ {
-		if s.args[i].castable {
-			var newQuery strings.Builder
-			var newArgStr string
-			newQuery.WriteString(s.query[:s.args[i].pos])
-			switch s.args[i]._type {
-			case TypeUnnamed:
-				newArgStr = fmt.Sprintf("CAST(? AS %s)", s.args[i].castType)
-			case TypeNamed:
-				newArgStr = fmt.Sprintf("CAST(:%s AS %s)", s.args[i].name, s.args[i].castType)
+	tArgs := make([]interface{}, 0, len(args))
+	bound := make(map[string]bool)
+	for _, a := range s.args {
+		if a.items > 0 {
+			// каждое вхождение раскрытого слайса - новые позиционные параметры
+			list := reflect.ValueOf(args[a.value].Value)
+			for i := 0; i < a.items; i++ {
+				tArgs = append(tArgs, convert(list.Index(i).Interface()))
 			}
-			fmt.Fprint(&newQuery, newArgStr)
-			newQuery.WriteString(s.query[s.args[i].pos+1+len(s.args[i].name):])
-			for j := i + 1; j < s.NumInput(); j++ {
-				s.args[j].pos += len(newArgStr) - 1 - len(s.args[i].name)
+			continue
+		}
+		val := convert(args[a.value].Value)
+		switch a._type {
+		case TypeUnnamed, TypeOrdinal:
+			tArgs = append(tArgs, val)
+		case TypeNamed:
+			if bound[a.name] {
+				continue
 			}
-			s.query = newQuery.String()
+			bound[a.name] = true
+			tArgs = append(tArgs, tarantool.KeyValueBind{Key: a.name, Value: val})
 		}
 	}
-	return nil
+	return tArgs
 }
 
-func makeArgs(args []driver.NamedValue) ([]interface{}, error) {
-	tArgs := make([]interface{}, len(args))
-	for _, v := range args {
-		val := covertValueForCustomTypes(v.Value)
-		var a interface{}
-		if v.Name != "" {
-			a = tarantool.KeyValueBind{Key: v.Name, Value: val}
-		} else {
-			a = val
+// Приведение значения к виду, для которого go-tarantool зарегистрировал msgpack расширение
+//
+// Расширения зарегистрированы для *datetime.Datetime, *decimal.Decimal, datetime.Interval и uuid.UUID,
+// nil-указатели заменяются на nil, т.к. msgpack не умеет кодировать типизированный nil.
+// time.Duration передается интервалом (см. time.NewInterval)
+func nativeValue(value driver.Value) driver.Value {
+	if v, ok := decimalValue(value); ok {
+		return v
+	}
+	switch v := value.(type) {
+	case *uuid.UUID:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case time.Time:
+		return &v.Datetime
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return &v.Datetime
+	case datetime.Datetime:
+		return &v
+	case *datetime.Datetime:
+		if v == nil {
+			return nil
+		}
+	case time.Interval:
+		return v.Interval
+	case *time.Interval:
+		if v == nil {
+			return nil
 		}
-		tArgs[v.Ordinal-1] = a
+		return v.Interval
+	case *datetime.Interval:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case stdtime.Duration:
+		return time.NewInterval(v).Interval
+	case Blob:
+		return []byte(v)
+	case readerData:
+		return []byte(v)
+	case Map:
+		return nativeMap(v)
+	case map[string]interface{}:
+		return nativeMap(v)
+	case Array:
+		return nativeSlice(v)
+	case []interface{}:
+		return nativeSlice(v)
+	}
+	return value
+}
+
+// Вложенные значения map и слайсов тоже приводятся к msgpack расширениям
+func nativeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = nativeValue(v)
+	}
+	return res
+}
+
+func nativeSlice(a []interface{}) []interface{} {
+	if a == nil {
+		return nil
+	}
+	res := make([]interface{}, len(a))
+	for i, v := range a {
+		res[i] = nativeValue(v)
 	}
-	return tArgs, nil
+	return res
 }
 
+// Приведение значения для режима cast_params
 func covertValueForCustomTypes(value driver.Value) driver.Value {
 	switch reflect.TypeOf(value) {
 	// временный вариант, т.к. с *uuid.UUID(nil) не работает msgpack, а просто с nil работает
@@ -317,37 +708,56 @@ func covertValueForCustomTypes(value driver.Value) driver.Value {
 		v := interface{}(t.ToTime().Format(time.RFC3339Nano))
 		return driver.Value(v)
 	}
-	return value
-}
-
-type result struct {
-	rowsAffected int64
-	lastInsertId int64
-}
-
-func (r *result) LastInsertId() (int64, error) {
-	return r.lastInsertId, nil
-}
-
-func (r *result) RowsAffected() (int64, error) {
-	return r.rowsAffected, nil
+	return nativeValue(value)
 }
 
+// Проверка и приведение параметра запроса, порядок описан в convert.go
 func checkNamedValue(value *driver.NamedValue) error {
 	if value == nil {
 		return nil
 	}
+	if conv, ok := lookupConverter(value.Value); ok {
+		v, err := conv(value.Value)
+		if err != nil {
+			return convertError(value, err)
+		}
+		value.Value = v
+		return nil
+	}
+	for depth := 0; ; depth++ {
+		ok, err := checkValue(value)
+		if err != nil || ok {
+			return err
+		}
+		if depth == maxConvertDepth {
+			return convertError(value, errConvertDepth)
+		}
+		v, ok, err := fallbackValue(value.Value)
+		if err != nil {
+			return convertError(value, err)
+		}
+		if !ok {
+			// Default is to fail, unless it is one of the supported types.
+			return fmt.Errorf("unsupported value type: %T", value.Value)
+		}
+		value.Value = v
+	}
+}
+
+// Типы, которые драйвер передает сам, ok = false для остальных
+func checkValue(value *driver.NamedValue) (ok bool, err error) {
 	switch t := value.Value.(type) {
 	default:
-		// Default is to fail, unless it is one of the following supported types.
-		return fmt.Errorf("unsupported value type: %v", t)
+		// map и слайсы любых типов уходят msgpack'ом (MAP и ARRAY в тарантуле),
+		// кроме реализующих driver.Valuer (type Tags []string) - для них сначала вызывается Value
+		if _, isValuer := t.(driver.Valuer); isValuer {
+			return false, nil
+		}
+		if k := reflect.TypeOf(t).Kind(); k == reflect.Map || k == reflect.Slice {
+			return true, nil
+		}
+		return false, nil
 	case nil:
-	case sql.NullInt64:
-	case sql.NullTime:
-	case sql.NullString:
-	case sql.NullFloat64:
-	case sql.NullBool:
-	case sql.NullInt32:
 	case string:
 	case []string:
 	case *string:
@@ -378,8 +788,27 @@ func checkNamedValue(value *driver.NamedValue) error {
 	case []*time.Time:
 	case uuid.UUID:
 	case *uuid.UUID:
+	case []uuid.UUID:
 	case datetime.Datetime:
 	case *datetime.Datetime:
+	case Map, Array, Blob:
+	case readerData:
+	case io.Reader:
+		// reader читается в память целиком и уходит как varbinary, повторно его не прочитать (см. stmt.checkErr)
+		data, err := io.ReadAll(t)
+		if err != nil {
+			return false, fmt.Errorf("can't read parameter %d: %w", value.Ordinal, err)
+		}
+		value.Value = readerData(data)
+	case stdtime.Time:
+		// например, из Valuer'ов sql.NullTime и time.Time
+		dt, err := datetime.NewDatetime(t)
+		if err != nil {
+			return false, convertError(value, err)
+		}
+		value.Value = *dt
+	case datetime.Interval, *datetime.Interval, time.Interval, *time.Interval, stdtime.Duration:
+	case Decimal, *Decimal, decimal.Decimal, *decimal.Decimal, tntdecimal.Decimal, *tntdecimal.Decimal, *big.Rat:
 	}
-	return nil
+	return true, nil
 }
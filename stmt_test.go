@@ -3,8 +3,13 @@ package tnt
 import (
 	"database/sql/driver"
 	"testing"
+	stdtime "time"
 
+	"github.com/aeroideaservices/tnt/time"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/tarantool/go-tarantool"
+	"github.com/tarantool/go-tarantool/datetime"
 )
 
 func TestParseArgs(t *testing.T) {
@@ -36,6 +41,18 @@ func TestParseArgs(t *testing.T) {
 			input:       `SELECT * FROM "test" WHERE "id"=:id, "name"=?, "age"=:age`,
 			wantNumArgs: 3,
 		},
+		{
+			input:       `SELECT 'a?b', "time:zone" FROM "test" WHERE "id"=? -- and "name"=?`,
+			wantNumArgs: 1,
+		},
+		{
+			input:       `SELECT * FROM "test" WHERE "id"=$1 OR "parent"=$1 OR "age"=$3`,
+			wantNumArgs: 3,
+		},
+		{ // смешанные стили, ошибку вернет выполнение
+			input:       `SELECT * FROM "test" WHERE "id"=$1 AND "name"=?`,
+			wantNumArgs: -1,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.input, func(t *testing.T) {
@@ -83,7 +100,7 @@ func TestBuildArgs(t *testing.T) {
 			},
 			wantError: false,
 		},
-		{ // todo
+		{
 			input: `SELECT * FROM "test" WHERE "id"=:id`,
 			sqlArgs: []driver.NamedValue{
 				{
@@ -103,6 +120,57 @@ func TestBuildArgs(t *testing.T) {
 			},
 			wantError: false,
 		},
+		{
+			input: `SELECT * FROM "test" WHERE "a"=:id OR "b"=? OR "c"=:id`,
+			sqlArgs: []driver.NamedValue{
+				{
+					Name:    "id",
+					Ordinal: 1,
+					Value:   3,
+				},
+				{
+					Name:    "",
+					Ordinal: 2,
+					Value:   4,
+				},
+			},
+			wantArgs: []arg{
+				{
+					pos:   31,
+					_type: TypeNamed,
+					name:  "id",
+					value: 0,
+				},
+				{
+					pos:   42,
+					_type: TypeUnnamed,
+					value: 1,
+				},
+				{
+					pos:   51,
+					_type: TypeNamed,
+					name:  "id",
+					value: 0,
+				},
+			},
+			wantError: false,
+		},
+		{
+			input: `SELECT * FROM "test" WHERE "a"=:id OR "b"=:id`,
+			sqlArgs: []driver.NamedValue{
+				{
+					Name:    "id",
+					Ordinal: 1,
+					Value:   3,
+				},
+				{
+					Name:    "id",
+					Ordinal: 2,
+					Value:   3,
+				},
+			},
+			wantError: true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.input, func(t *testing.T) {
@@ -126,3 +194,172 @@ func TestBuildArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestBindArgsRepeatedNamed(t *testing.T) {
+	s := stmt{
+		rawQuery: `SELECT * FROM "t" WHERE "a"=:at OR "b"=? OR "c"=:at`,
+		conn:     &conn{connector: &connector{config: Config{CastParams: true}}},
+	}
+	if n := s.NumInput(); n != 2 {
+		t.Fatalf("NumInput() = %d, want 2", n)
+	}
+	at, err := time.Parse("2006-01-02", "2023-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		tArgs, err := s.bindArgs([]driver.NamedValue{
+			{Name: "at", Ordinal: 1, Value: at},
+			{Ordinal: 2, Value: 5},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantQuery := `SELECT * FROM "t" WHERE "a"=CAST(:at AS DATETIME) OR "b"=? OR "c"=CAST(:at AS DATETIME)`
+		if s.query != wantQuery {
+			t.Errorf("query = %q, want %q", s.query, wantQuery)
+		}
+		wantArgs := []interface{}{
+			tarantool.KeyValueBind{Key: "at", Value: covertValueForCustomTypes(at)},
+			5,
+		}
+		if !cmp.Equal(tArgs, wantArgs) {
+			t.Errorf("args mismatch\ngot: %v\nwant %v", tArgs, wantArgs)
+		}
+	}
+}
+
+func TestBindArgsRewrite(t *testing.T) {
+	at, err := time.Parse("2006-01-02", "2023-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	tests := []struct {
+		input      string
+		sqlArgs    []driver.NamedValue
+		wantQuery  string
+		wantArgs   []interface{}
+		wantError  bool
+		castParams bool
+	}{
+		{
+			input:     `SELECT * FROM "t" WHERE "id" IN (?) AND "a"=?`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: []int{1, 2, 3}}, {Ordinal: 2, Value: "x"}},
+			wantQuery: `SELECT * FROM "t" WHERE "id" IN (?, ?, ?) AND "a"=?`,
+			wantArgs:  []interface{}{1, 2, 3, "x"},
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "a"=:a AND "id" in ( :ids ) OR "id" IN (:ids)`,
+			sqlArgs:   []driver.NamedValue{{Name: "a", Ordinal: 1, Value: "x"}, {Name: "ids", Ordinal: 2, Value: []string{"b", "c"}}},
+			wantQuery: `SELECT * FROM "t" WHERE "a"=:a AND "id" in ( ?, ? ) OR "id" IN (?, ?)`,
+			wantArgs:  []interface{}{tarantool.KeyValueBind{Key: "a", Value: "x"}, "b", "c", "b", "c"},
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "at" IN (?)`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: []time.Time{at}}},
+			wantQuery: `SELECT * FROM "t" WHERE "at" IN (?)`,
+			wantArgs:  []interface{}{&at.Datetime},
+		},
+		{
+			input:      `SELECT * FROM "t" WHERE "at" IN (?)`,
+			sqlArgs:    []driver.NamedValue{{Ordinal: 1, Value: []time.Time{at}}},
+			wantQuery:  `SELECT * FROM "t" WHERE "at" IN (CAST(? AS DATETIME))`,
+			wantArgs:   []interface{}{covertValueForCustomTypes(at)},
+			castParams: true,
+		},
+		{ // uuid и время без CAST, msgpack расширениями
+			input:     `SELECT * FROM "t" WHERE "id"=? AND "at"=? AND "parent"=?`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: id}, {Ordinal: 2, Value: at.Datetime}, {Ordinal: 3, Value: (*uuid.UUID)(nil)}},
+			wantQuery: `SELECT * FROM "t" WHERE "id"=? AND "at"=? AND "parent"=?`,
+			wantArgs:  []interface{}{id, &at.Datetime, nil},
+		},
+		{
+			input:     `SELECT ? + ?, ?`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: at}, {Ordinal: 2, Value: 90 * stdtime.Minute}, {Ordinal: 3, Value: (*time.Interval)(nil)}},
+			wantQuery: `SELECT ? + ?, ?`,
+			wantArgs:  []interface{}{&at.Datetime, datetime.Interval{Hour: 1, Min: 30}, nil},
+		},
+		{ // слайс вне IN передается как есть
+			input:     `INSERT INTO "t" VALUES (?, ?)`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: 1}, {Ordinal: 2, Value: []int{1, 2}}},
+			wantQuery: `INSERT INTO "t" VALUES (?, ?)`,
+			wantArgs:  []interface{}{1, []int{1, 2}},
+		},
+		{ // []byte - это varbinary, а не список
+			input:     `SELECT * FROM "t" WHERE "b" IN (?)`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: []byte("ab")}},
+			wantQuery: `SELECT * FROM "t" WHERE "b" IN (?)`,
+			wantArgs:  []interface{}{[]byte("ab")},
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "a"=$2 AND "b"=$1 AND "c" IN ($2) OR "d"=$01`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: "x"}, {Ordinal: 2, Value: []int{7, 8}}},
+			wantQuery: `SELECT * FROM "t" WHERE "a"=? AND "b"=? AND "c" IN (?, ?) OR "d"=?`,
+			wantArgs:  []interface{}{[]int{7, 8}, "x", 7, 8, "x"},
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "a"=$1 AND "b"=:b`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: "x"}, {Name: "b", Ordinal: 2, Value: "y"}},
+			wantError: true,
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "a"=$0`,
+			sqlArgs:   []driver.NamedValue{},
+			wantError: true,
+		},
+		{
+			input:     `SELECT * FROM "t" WHERE "id" NOT IN (?)`,
+			sqlArgs:   []driver.NamedValue{{Ordinal: 1, Value: []int{}}},
+			wantError: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			s := stmt{
+				rawQuery: tc.input,
+				conn:     &conn{connector: &connector{config: Config{CastParams: tc.castParams}}},
+			}
+			tArgs, err := s.bindArgs(tc.sqlArgs)
+			if err != nil {
+				if !tc.wantError {
+					t.Error(err)
+				}
+				return
+			}
+			if tc.wantError {
+				t.Fatal("did not encounter expected error")
+			}
+			if s.query != tc.wantQuery {
+				t.Errorf("query = %q, want %q", s.query, tc.wantQuery)
+			}
+			if !cmp.Equal(tArgs, tc.wantArgs, datetimeComparer) {
+				t.Errorf("args mismatch\ngot: %v\nwant %v", tArgs, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestExpandsList(t *testing.T) {
+	s := stmt{
+		rawQuery: `SELECT * FROM "t" WHERE "id" IN (?) AND "a"=?`,
+		conn:     &conn{connector: &connector{}},
+	}
+	// варианты с раскрытым IN не подготавливаются на сервере, см. stmt.execute
+	if _, err := s.bindArgs([]driver.NamedValue{{Ordinal: 1, Value: []int{1, 2}}, {Ordinal: 2, Value: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.expandsList() {
+		t.Error("expanded IN list was not detected")
+	}
+	if _, err := s.bindArgs([]driver.NamedValue{{Ordinal: 1, Value: 1}, {Ordinal: 2, Value: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if s.expandsList() {
+		t.Error("scalar IN parameter must not be expanded")
+	}
+}
+
+var datetimeComparer = cmp.Comparer(func(a, b *datetime.Datetime) bool {
+	return a.ToTime().Equal(b.ToTime())
+})
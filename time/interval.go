@@ -0,0 +1,48 @@
+package time
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/tarantool/go-tarantool/datetime"
+)
+
+// Interval обертка над INTERVAL тарантула, для сканирования результатов и передачи в параметрах
+type Interval struct {
+	datetime.Interval
+}
+
+// NewInterval переводит time.Duration в интервал из часов, минут, секунд и наносекунд
+// (дни, месяцы и годы в тарантуле зависят от календаря, поэтому не используются)
+func NewInterval(d time.Duration) Interval {
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	mins := d / time.Minute
+	d -= mins * time.Minute
+	secs := d / time.Second
+	d -= secs * time.Second
+	return Interval{datetime.Interval{
+		Hour: int64(hours),
+		Min:  int64(mins),
+		Sec:  int64(secs),
+		Nsec: int64(d),
+	}}
+}
+
+func (i *Interval) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case datetime.Interval:
+		*i = Interval{src}
+	default:
+		return fmt.Errorf("Scan: unable to scan type %T into tnt.Interval", src)
+	}
+	return nil
+}
+
+// Value отдает datetime.Interval, драйвер передает его msgpack расширением
+func (i Interval) Value() (driver.Value, error) {
+	return i.Interval, nil
+}
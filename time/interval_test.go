@@ -0,0 +1,35 @@
+package time
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool/datetime"
+)
+
+func TestNewInterval(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want datetime.Interval
+	}{
+		{d: 0, want: datetime.Interval{}},
+		{d: 90*time.Minute + 1500*time.Millisecond, want: datetime.Interval{Hour: 1, Min: 30, Sec: 1, Nsec: 5e8}},
+		{d: -(26*time.Hour + time.Nanosecond), want: datetime.Interval{Hour: -26, Nsec: -1}},
+	}
+	for _, tc := range tests {
+		if got := NewInterval(tc.d).Interval; got != tc.want {
+			t.Errorf("NewInterval(%v) = %+v, want %+v", tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestIntervalScan(t *testing.T) {
+	var i Interval
+	want := datetime.Interval{Day: 2, Adjust: datetime.LastAdjust}
+	if err := i.Scan(want); err != nil || i.Interval != want {
+		t.Errorf("Scan(%+v) = %+v, %v", want, i.Interval, err)
+	}
+	if err := i.Scan("1 day"); err == nil {
+		t.Error("did not encounter expected error for string")
+	}
+}
@@ -1,6 +1,7 @@
 package time
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"time"
 
@@ -47,6 +48,12 @@ func (t *Time) Scan(src interface{}) error {
 	return nil
 }
 
+// Value отдает стандартный time.Time, так что Time можно передавать параметром и в другие драйверы
+// (tnt драйвер передает его msgpack расширением datetime)
+func (t Time) Value() (driver.Value, error) {
+	return t.ToTime(), nil
+}
+
 func Parse(layout, value string) (t Time, err error) {
 	tt, err := time.Parse(layout, value)
 	if err != nil {
@@ -2,68 +2,169 @@ package tnt
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/tarantool/go-tarantool"
 )
 
 /*
-	Транзакции в тарантуле дело очень не приятное, благо у нас они нигде особо не использовались
-	Взаимодействие с "потоками" дело не простое, поэтому для простоты я сделал поддержку в обном соединении
-	лишь одной транзакции, может быть можно сделать их и больше
+	Транзакции работают через "потоки" тарантула: каждая транзакция получает свой stream
+	на общем (мультиплексированном) tarantool соединении слота, запросы транзакции уходят с его id,
+	так что сервер отличает их от запросов других транзакций на том же соединении.
+	Поэтому сколько угодно "внутренних" соединений database/sql могут одновременно держать
+	независимые транзакции поверх одного сокета.
+
+	Состояние транзакции (stream, closed) хранится в tx под его мютексом, "внутреннее" соединение
+	только ссылается на свою текущую транзакцию (conn.tx под conn.mu).
+
+	Что гарантируется после Commit/Rollback (в том числе завершившихся ошибкой):
+	- соединение больше не в транзакции, следующие запросы выполняются вне ее, а BeginTx открывает
+	новый stream, старый никогда не переиспользуется
+	- любые вызовы на завершенной tx возвращают ошибку и не уходят на сервер
+	- если commit/rollback не дошел до сервера (ошибка сети), соединение помечается сломанным и
+	database/sql его выбросит; оставшуюся на сервере транзакцию прервет таймаут (см. tx_timeout)
 */
 
 type tx struct {
-	conn   *conn
-	stream *tarantool.Stream
-	closed bool
+	mu       sync.Mutex
+	conn     *conn
+	stream   *tarantool.Stream
+	closed   bool
+	readOnly bool // TxOptions.ReadOnly, изменяющие запросы отклоняются драйвером
 }
 
-func (tx *tx) Commit() (err error) {
-	if tx.conn == nil || tx.conn.closed {
-		return driver.ErrBadConn
+var errTxClosed = errors.New("transaction already closed")
+
+// Соответствие уровней изоляции database/sql уровням тарантула
+//
+// read-committed в тарантуле видит изменения, еще не подтвержденные синхронной репликацией, поэтому
+// он соответствует READ UNCOMMITTED, а READ COMMITTED - это read-confirmed.
+// best-effort (MVCC с обнаружением конфликтов) используется по умолчанию и для SERIALIZABLE
+func isolationLevel(level driver.IsolationLevel) (tarantool.TxnIsolationLevel, error) {
+	switch sql.IsolationLevel(level) {
+	case sql.LevelDefault, sql.LevelSerializable:
+		return tarantool.BestEffortLevel, nil
+	case sql.LevelReadCommitted:
+		return tarantool.ReadConfirmedLevel, nil
+	case sql.LevelReadUncommitted:
+		return tarantool.ReadCommittedLevel, nil
 	}
-	if tx.closed {
-		return errors.New("transaction already closed")
+	return 0, fmt.Errorf("isolation level %s is not supported", sql.IsolationLevel(level))
+}
+
+// Можно ли выполнить запрос в read-only транзакции
+//
+// Проверяется только текст запроса: SELECT, VALUES и EXPLAIN, WITH без изменяющих
+// ключевых слов, а также работа с точками сохранения (см. savepoint.go).
+// Изменения внутри вызываемых из запроса функций драйвер не видит
+func isReadOnlyQuery(query string) bool {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return true
+	}
+	switch first := tokens[0]; {
+	case first.is("SELECT"), first.is("VALUES"), first.is("EXPLAIN"):
+		return true
+	case first.is("SAVEPOINT"), first.is("RELEASE"), first.is("ROLLBACK"):
+		return true
+	case first.is("WITH"):
+		for _, t := range tokens {
+			if t.is("INSERT") || t.is("UPDATE") || t.is("DELETE") || t.is("REPLACE") {
+				return false
+			}
+		}
+		return true
 	}
+	return false
+}
 
-	r, err := tx.stream.Do(tarantool.NewCommitRequest()).Get()
-	if err == nil && r.Error != "" {
-		err = errors.New(r.Error)
+// Проверка запроса перед выполнением в транзакции
+func (tx *tx) check(query string) error {
+	if tx.readOnly && !isReadOnlyQuery(query) {
+		return ErrReadOnlyTransaction
 	}
+	return nil
+}
 
-	tx.closed = true
-	tx.conn.inTx = false
-	tx.conn.tx = nil
-	tx.conn = nil
-	return
+func (tx *tx) Commit() error {
+	return tx.finish(context.Background(), true)
 }
 
-func (tx *tx) Rollback() (err error) {
-	if tx.conn == nil || tx.conn.closed {
-		return driver.ErrBadConn
-	}
+func (tx *tx) Rollback() error {
+	return tx.rollback(context.Background())
+}
+
+func (tx *tx) rollback(ctx context.Context) error {
+	return tx.finish(ctx, false)
+}
+
+// Завершение транзакции commit'ом или rollback'ом, после чего соединение отвязывается от нее
+// независимо от результата
+func (tx *tx) finish(ctx context.Context, commit bool) (err error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
 	if tx.closed {
-		return errors.New("transaction already closed")
+		return errTxClosed
+	}
+	if tx.conn.closed {
+		return driver.ErrBadConn
 	}
 
-	r, err := tx.stream.Do(tarantool.NewRollbackRequest()).Get()
+	ctx, cancel := tx.conn.connector.requestContext(ctx)
+	defer cancel()
+	var req tarantool.Request = tarantool.NewRollbackRequest().Context(ctx)
+	if commit {
+		req = tarantool.NewCommitRequest().Context(ctx)
+	}
+	r, err := await(ctx, tx.stream.Do(req))
 	if err == nil && r.Error != "" {
-		err = errors.New(r.Error)
+		err = &Error{Code: r.Code, Message: r.Error}
+	}
+	if err != nil {
+		err = newError(err, "")
+		// помечаем сломанное соединение, но ErrBadConn наружу не отдаем,
+		// повторять commit/rollback на другом соединении бессмысленно
+		tx.conn.checkErr(err)
 	}
 
 	tx.closed = true
-	tx.conn.inTx = false
-	tx.conn.tx = nil
+	tx.conn.endTx(tx)
 	tx.conn = nil
 	return
 }
 
+// Соединение и stream еще не завершенной транзакции
+func (tx *tx) active() (*conn, *tarantool.Stream, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return nil, nil, errTxClosed
+	}
+	return tx.conn, tx.stream, nil
+}
+
 func (tx *tx) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	return NewStmt(tx.conn, query, tx.stream).ExecContext(ctx, args)
+	c, stream, err := tx.active()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.check(query); err != nil {
+		return nil, err
+	}
+	return NewStmt(c, query, stream).ExecContext(ctx, args)
 }
 
 func (tx *tx) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	return NewStmt(tx.conn, query, tx.stream).QueryContext(ctx, args)
+	c, stream, err := tx.active()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.check(query); err != nil {
+		return nil, err
+	}
+	return NewStmt(c, query, stream).QueryContext(ctx, args)
 }
@@ -0,0 +1,152 @@
+package tnt
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+)
+
+func TestIsolationLevel(t *testing.T) {
+	tests := []struct {
+		level     sql.IsolationLevel
+		want      tarantool.TxnIsolationLevel
+		wantError bool
+	}{
+		{level: sql.LevelDefault, want: tarantool.BestEffortLevel},
+		{level: sql.LevelSerializable, want: tarantool.BestEffortLevel},
+		{level: sql.LevelReadCommitted, want: tarantool.ReadConfirmedLevel},
+		{level: sql.LevelReadUncommitted, want: tarantool.ReadCommittedLevel},
+		{level: sql.LevelRepeatableRead, wantError: true},
+		{level: sql.LevelSnapshot, wantError: true},
+		{level: sql.LevelLinearizable, wantError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			got, err := isolationLevel(driver.IsolationLevel(tc.level))
+			if (err != nil) != tc.wantError {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("level mismatch\nGot: %v\nWant: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadOnlyTx(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: `SELECT * FROM "test"`, want: true},
+		{query: ` /* report */ select 1`, want: true},
+		{query: `VALUES (1, 2)`, want: true},
+		{query: `EXPLAIN QUERY PLAN SELECT 1`, want: true},
+		{query: `WITH t AS (SELECT 1) SELECT * FROM t`, want: true},
+		{query: `WITH t AS (SELECT 1) SELECT * FROM t WHERE 'DELETE' = "update"`, want: true},
+		{query: `WITH t AS (SELECT 1) INSERT INTO "test" SELECT * FROM t`, want: false},
+		{query: `INSERT INTO "test" VALUES (1)`, want: false},
+		{query: `UPDATE "test" SET "a" = 1`, want: false},
+		{query: `CREATE TABLE t (id INT PRIMARY KEY)`, want: false},
+		{query: `SAVEPOINT "sp"`, want: true},
+		{query: `ROLLBACK TO SAVEPOINT "sp"`, want: true},
+	}
+	tx := &tx{readOnly: true}
+	for _, tc := range tests {
+		err := tx.check(tc.query)
+		if tc.want && err != nil {
+			t.Errorf("unexpected error for %q: %v", tc.query, err)
+		}
+		if !tc.want && (!errors.Is(err, ErrReadOnlyTransaction) || !IsReadOnly(err)) {
+			t.Errorf("unexpected error for %q\nGot: %v\nWant: %v", tc.query, err, ErrReadOnlyTransaction)
+		}
+	}
+	tx.readOnly = false
+	if err := tx.check(`DELETE FROM "test"`); err != nil {
+		t.Errorf("unexpected error for read-write transaction: %v", err)
+	}
+}
+
+func TestTxTimeout(t *testing.T) {
+	c := &conn{connector: &connector{}}
+	if got := c.txTimeout(context.Background()); got != 0 {
+		t.Errorf("timeout without config and deadline = %v, want 0", got)
+	}
+	c.connector.config.TxTimeout = 5 * time.Second
+	if got := c.txTimeout(context.Background()); got != 5*time.Second {
+		t.Errorf("timeout from config = %v, want 5s", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if got := c.txTimeout(ctx); got <= 0 || got > time.Second {
+		t.Errorf("timeout from context = %v, want up to 1s", got)
+	}
+	long, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if got := c.txTimeout(long); got != 5*time.Second {
+		t.Errorf("timeout with far deadline = %v, want 5s", got)
+	}
+}
+
+func TestFinishedTx(t *testing.T) {
+	c := &conn{connector: &connector{}}
+	finished := &tx{conn: c, closed: true}
+	current := &tx{conn: c}
+	c.tx = current
+
+	if err := finished.Commit(); !errors.Is(err, errTxClosed) {
+		t.Errorf("unexpected error for Commit\nGot: %v\nWant: %v", err, errTxClosed)
+	}
+	if err := finished.Rollback(); !errors.Is(err, errTxClosed) {
+		t.Errorf("unexpected error for Rollback\nGot: %v\nWant: %v", err, errTxClosed)
+	}
+	if _, err := finished.ExecContext(context.Background(), `DELETE FROM "test"`, nil); !errors.Is(err, errTxClosed) {
+		t.Errorf("unexpected error for ExecContext\nGot: %v\nWant: %v", err, errTxClosed)
+	}
+	if _, err := finished.QueryContext(context.Background(), `SELECT 1`, nil); !errors.Is(err, errTxClosed) {
+		t.Errorf("unexpected error for QueryContext\nGot: %v\nWant: %v", err, errTxClosed)
+	}
+
+	// завершение чужой транзакции не отвязывает текущую
+	c.endTx(finished)
+	if c.currentTx() != current {
+		t.Fatal("current transaction was detached by another one")
+	}
+	c.endTx(current)
+	if c.currentTx() != nil {
+		t.Fatal("finished transaction is still attached to conn")
+	}
+}
+
+func TestCloseRollbackTimeout(t *testing.T) {
+	c := &conn{connector: &connector{}}
+	if got := c.closeRollbackTimeout(); got != closeRollbackTimeout {
+		t.Errorf("timeout without tx_timeout = %v, want %v", got, closeRollbackTimeout)
+	}
+	c.connector.config.TxTimeout = time.Second
+	if got := c.closeRollbackTimeout(); got != time.Second {
+		t.Errorf("timeout with tx_timeout = %v, want %v", got, time.Second)
+	}
+	c.connector.config.TxTimeout = time.Minute
+	if got := c.closeRollbackTimeout(); got != closeRollbackTimeout {
+		t.Errorf("timeout with long tx_timeout = %v, want %v", got, closeRollbackTimeout)
+	}
+}
+
+func TestPreparedStmtUsesCurrentTx(t *testing.T) {
+	c := &conn{connector: &connector{}}
+	// выражение подготовлено до BeginTx, а выполняется уже в read-only транзакции (Tx.StmtContext)
+	s := NewStmt(c, `DELETE FROM "test"`, nil)
+	c.tx = &tx{conn: c, readOnly: true}
+	if _, err := s.ExecContext(context.Background(), nil); !errors.Is(err, ErrReadOnlyTransaction) {
+		t.Errorf("unexpected error for ExecContext\nGot: %v\nWant: %v", err, ErrReadOnlyTransaction)
+	}
+	if _, err := s.QueryContext(context.Background(), nil); !errors.Is(err, ErrReadOnlyTransaction) {
+		t.Errorf("unexpected error for QueryContext\nGot: %v\nWant: %v", err, ErrReadOnlyTransaction)
+	}
+}